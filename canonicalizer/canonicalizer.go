@@ -0,0 +1,261 @@
+// Package canonicalizer rewrites URLs into a canonical form, so that
+// variants of one URL, such as http://site and http://SITE:80/index.html,
+// are crawled once.
+package canonicalizer
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// The names of the rules, as accepted by Parse.
+const (
+	RuleLowercase   = "lowercase"
+	RuleDefaultPort = "default-port"
+	RuleEmptyPath   = "empty-path"
+	RuleDotSegments = "dot-segments"
+	RuleIndexFiles  = "index-files"
+	RuleAddSlash    = "add-slash"
+	RuleRemoveSlash = "remove-slash"
+	RuleSortQuery   = "sort-query"
+	RuleStripParams = "strip-params"
+)
+
+// DefaultStripParams are query parameters that track visitors or sessions
+// without changing the page. Names ending in * match any parameter they prefix.
+var DefaultStripParams = []string{
+	"utm_*", "gclid", "dclid", "fbclid", "msclkid", "mc_cid", "mc_eid", "_ga",
+	"sessionid", "session_id", "sid", "jsessionid", "phpsessid", "aspsessionid",
+}
+
+// DefaultIndexFiles are the file names servers typically serve for a directory.
+var DefaultIndexFiles = []string{"index.html", "index.htm", "index.php", "default.htm", "default.html", "default.aspx"}
+
+// A Canonicalizer rewrites URLs by the rules enabled in it. Fragments are
+// always removed. A nil *Canonicalizer only removes fragments.
+type Canonicalizer struct {
+	// Lowercase lowercases the scheme and host.
+	Lowercase bool
+	// DefaultPort removes the port if it is the scheme's default, e.g. :80 for http.
+	DefaultPort bool
+	// EmptyPath makes an empty path "/", so http://site is http://site/.
+	EmptyPath bool
+	// DotSegments resolves "." and ".." segments in the path.
+	DotSegments bool
+	// IndexFiles lists file names that are removed from the end of a path,
+	// so /docs/index.html is /docs/.
+	IndexFiles []string
+	// AddSlash adds a trailing slash to paths whose last segment has no
+	// file extension, so /docs is /docs/.
+	AddSlash bool
+	// RemoveSlash removes the trailing slash from paths other than "/", so
+	// /docs/ is /docs. It is ignored if AddSlash is set.
+	RemoveSlash bool
+	// SortQuery sorts query parameters by name, keeping the order of
+	// repeated parameters.
+	SortQuery bool
+	// StripParams lists query parameters to remove, case-insensitively.
+	// Names ending in * remove every parameter they prefix.
+	StripParams []string
+}
+
+// Default returns a Canonicalizer with every rule enabled except AddSlash
+// and RemoveSlash, which change URLs that servers may treat differently.
+func Default() *Canonicalizer {
+	return &Canonicalizer{
+		Lowercase:   true,
+		DefaultPort: true,
+		EmptyPath:   true,
+		DotSegments: true,
+		IndexFiles:  DefaultIndexFiles,
+		SortQuery:   true,
+		StripParams: DefaultStripParams,
+	}
+}
+
+// Parse returns a Canonicalizer with the comma-separated rules in s enabled.
+// "default" enables the rules of Default, and "none" or "" enables none.
+// index-files and strip-params use DefaultIndexFiles and DefaultStripParams.
+func Parse(s string) (*Canonicalizer, error) {
+	c := &Canonicalizer{}
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "", "none":
+		case "default":
+			d := Default()
+			d.AddSlash, d.RemoveSlash = c.AddSlash, c.RemoveSlash
+			*c = *d
+		case RuleLowercase:
+			c.Lowercase = true
+		case RuleDefaultPort:
+			c.DefaultPort = true
+		case RuleEmptyPath:
+			c.EmptyPath = true
+		case RuleDotSegments:
+			c.DotSegments = true
+		case RuleIndexFiles:
+			c.IndexFiles = DefaultIndexFiles
+		case RuleAddSlash:
+			c.AddSlash = true
+		case RuleRemoveSlash:
+			c.RemoveSlash = true
+		case RuleSortQuery:
+			c.SortQuery = true
+		case RuleStripParams:
+			c.StripParams = DefaultStripParams
+		default:
+			return nil, fmt.Errorf("unknown canonicalization rule %q", name)
+		}
+	}
+	return c, nil
+}
+
+// URL returns the canonical form of u.
+func (c *Canonicalizer) URL(u url.URL) url.URL {
+	u.Fragment, u.RawFragment = "", ""
+	if c == nil || u.Opaque != "" {
+		return u
+	}
+
+	if c.Lowercase {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+	}
+	if c.DefaultPort {
+		port := u.Port()
+		if port == "80" && strings.EqualFold(u.Scheme, "http") || port == "443" && strings.EqualFold(u.Scheme, "https") {
+			u.Host = strings.TrimSuffix(u.Host, ":"+port)
+		}
+	}
+
+	p := u.EscapedPath()
+	if c.DotSegments {
+		p = removeDotSegments(p)
+	}
+	if i := strings.LastIndexByte(p, '/'); i != -1 {
+		for _, index := range c.IndexFiles {
+			if strings.EqualFold(p[i+1:], index) {
+				p = p[:i+1]
+				break
+			}
+		}
+	}
+	switch {
+	case c.AddSlash:
+		last := p[strings.LastIndexByte(p, '/')+1:]
+		if last != "" && !strings.Contains(last, ".") {
+			p += "/"
+		}
+	case c.RemoveSlash:
+		if len(p) > 1 {
+			p = strings.TrimSuffix(p, "/")
+		}
+	}
+	if p == "" && c.EmptyPath && u.Host != "" {
+		p = "/"
+	}
+	setPath(&u, p)
+
+	if c.SortQuery || len(c.StripParams) > 0 {
+		u.RawQuery = c.query(u.RawQuery)
+		if u.RawQuery != "" {
+			u.ForceQuery = false
+		}
+	}
+	return u
+}
+
+// query returns rawQuery with the parameters to strip removed, and sorted
+// if SortQuery is set. Parameters are not re-encoded.
+func (c *Canonicalizer) query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param != "" && !c.strip(paramName(param)) {
+			params = append(params, param)
+		}
+	}
+	if c.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return paramName(params[i]) < paramName(params[j])
+		})
+	}
+	return strings.Join(params, "&")
+}
+
+// strip reports whether the parameter called name should be removed.
+func (c *Canonicalizer) strip(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range c.StripParams {
+		s = strings.ToLower(s)
+		if prefix := strings.TrimSuffix(s, "*"); prefix != s {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == s {
+			return true
+		}
+	}
+	return false
+}
+
+// paramName returns the unescaped name of a name=value query parameter.
+func paramName(param string) string {
+	name := param
+	if i := strings.IndexByte(param, '='); i != -1 {
+		name = param[:i]
+	}
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+// removeDotSegments resolves the "." and ".." segments of an absolute path,
+// as in RFC 3986 section 5.2.4.
+func removeDotSegments(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return p
+	}
+	segments := strings.Split(p[1:], "/")
+	out := make([]string, 0, len(segments))
+	for i, s := range segments {
+		last := i == len(segments)-1
+		switch s {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, s)
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
+
+// setPath sets the path of u to the escaped path p, only keeping RawPath
+// if p is not the default encoding, so equal URLs compare equal.
+func setPath(u *url.URL, p string) {
+	if p == u.EscapedPath() {
+		return
+	}
+	unescaped, err := url.PathUnescape(p)
+	if err != nil {
+		return
+	}
+	u.Path, u.RawPath = unescaped, ""
+	if u.EscapedPath() != p {
+		u.RawPath = p
+	}
+}
@@ -0,0 +1,87 @@
+package canonicalizer
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	testCases := map[string]string{
+		"http://finely.co":                              "http://finely.co/",
+		"http://finely.co/":                             "http://finely.co/",
+		"HTTP://Finely.CO:80/About/":                    "http://finely.co/About/",
+		"https://finely.co:443/":                        "https://finely.co/",
+		"https://finely.co:8443/":                       "https://finely.co:8443/",
+		"http://finely.co/index.html":                   "http://finely.co/",
+		"http://finely.co/work/INDEX.HTM":               "http://finely.co/work/",
+		"http://finely.co/a/./b/../c":                   "http://finely.co/a/c",
+		"http://finely.co/a/b/..":                       "http://finely.co/a/",
+		"http://finely.co/../../a":                      "http://finely.co/a",
+		"http://finely.co/?b=2&a=1&b=1":                 "http://finely.co/?a=1&b=2&b=1",
+		"http://finely.co/?utm_source=x&p=1&UTM_TERM=y": "http://finely.co/?p=1",
+		"http://finely.co/?fbclid=x":                    "http://finely.co/",
+		"http://finely.co/page#top":                     "http://finely.co/page",
+		"http://finely.co/a%2Fb/./c":                    "http://finely.co/a%2Fb/c",
+		"http://finely.co/docs":                         "http://finely.co/docs",
+	}
+
+	c := Default()
+	for in, want := range testCases {
+		assert.Equal(t, want, canonical(c, in), in)
+	}
+}
+
+func TestCanonicalURLsAreEqual(t *testing.T) {
+	c := Default()
+	assert.Equal(t, c.URL(parseURL("http://finely.co/a/./b")), c.URL(parseURL("http://finely.co/a/b")))
+	assert.Equal(t, c.URL(parseURL("http://finely.co")), c.URL(parseURL("http://finely.co/index.php?utm_medium=email")))
+}
+
+func TestSlashRules(t *testing.T) {
+	add := &Canonicalizer{AddSlash: true}
+	assert.Equal(t, "http://finely.co/docs/", canonical(add, "http://finely.co/docs"))
+	assert.Equal(t, "http://finely.co/docs/intro.html", canonical(add, "http://finely.co/docs/intro.html"))
+
+	remove := &Canonicalizer{RemoveSlash: true, EmptyPath: true}
+	assert.Equal(t, "http://finely.co/docs", canonical(remove, "http://finely.co/docs/"))
+	assert.Equal(t, "http://finely.co/", canonical(remove, "http://finely.co/"))
+}
+
+func TestRulesAreToggleable(t *testing.T) {
+	var none *Canonicalizer
+	assert.Equal(t, "http://Finely.CO:80/index.html?b=1&a=2", canonical(none, "HTTP://Finely.CO:80/index.html?b=1&a=2#top"))
+
+	strip := &Canonicalizer{StripParams: []string{"ref"}}
+	assert.Equal(t, "http://finely.co/?b=1&a=2", canonical(strip, "http://finely.co/?b=1&ref=x&a=2"))
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse("lowercase,sort-query")
+	assert.NoError(t, err)
+	assert.Equal(t, &Canonicalizer{Lowercase: true, SortQuery: true}, c)
+
+	c, err = Parse("remove-slash,default")
+	assert.NoError(t, err)
+	want := Default()
+	want.RemoveSlash = true
+	assert.Equal(t, want, c)
+
+	c, err = Parse("none")
+	assert.NoError(t, err)
+	assert.Equal(t, &Canonicalizer{}, c)
+
+	_, err = Parse("lowercase,nope")
+	assert.EqualError(t, err, `unknown canonicalization rule "nope"`)
+}
+
+func parseURL(s string) url.URL {
+	u, _ := url.Parse(s)
+	return *u
+}
+
+func canonical(c *Canonicalizer, s string) string {
+	u := c.URL(parseURL(s))
+	return u.String()
+}
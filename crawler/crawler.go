@@ -0,0 +1,500 @@
+// Package crawler crawls websites, producing a graph of their pages and assets.
+package crawler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/geotho/aragog/canonicalizer"
+	"github.com/geotho/aragog/parse"
+	"github.com/geotho/aragog/resource"
+	"github.com/geotho/aragog/robots"
+)
+
+const (
+	// DefaultMaxCrawlers is used when Options.MaxCrawlers is not set.
+	DefaultMaxCrawlers = 20
+	// DefaultUserAgent is used when Options.UserAgent is not set.
+	DefaultUserAgent = "aragog/1.0 (+https://github.com/geotho/aragog)"
+	// DefaultDrainTimeout is used when Options.DrainTimeout is not set.
+	DefaultDrainTimeout = 10 * time.Second
+)
+
+// errExcluded stops a redirect chain at a URL Options.Excluded keeps out.
+var errExcluded = errors.New("excluded from the crawl")
+
+// Options configures a Crawler.
+type Options struct {
+	// Seeds are the URLs to start crawling from.
+	Seeds []url.URL
+	// MaxCrawlers is the maximum number of concurrent fetches. Fetches
+	// waiting for a host's politeness limits do not count.
+	MaxCrawlers int
+	// InScope reports whether a discovered URL may be crawled.
+	// If nil, URLs on the same host as any of the Seeds are in scope.
+	InScope func(url.URL) bool
+	// Excluded reports whether an out-of-scope URL is kept out by a rule,
+	// rather than being on another site. Excluded URLs are never requested,
+	// even with CheckExternal, and are not recorded. If nil, no URL is.
+	Excluded func(url.URL) bool
+	// Canonicalizer rewrites the seeds and every discovered URL before it is
+	// crawled or recorded, so variants of a URL are crawled once. If nil,
+	// only fragments are removed.
+	Canonicalizer *canonicalizer.Canonicalizer
+	// Client is used to make requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// UserAgent is sent with every request. Its product token, e.g. "aragog",
+	// selects the robots.txt rules to obey.
+	UserAgent string
+	// IgnoreRobots disables robots.txt rules and Crawl-delay.
+	IgnoreRobots bool
+	// CheckAssets requests the headers of every in-scope asset, not just
+	// stylesheets, so broken images and scripts are found.
+	CheckAssets bool
+	// CheckExternal requests the headers of each out-of-scope link and asset
+	// once, without crawling it, so rotten external references are found.
+	CheckExternal bool
+	// SitemapSeeds also crawls the in-scope pages listed in the sitemaps of
+	// the seeds' hosts, found from robots.txt Sitemap: directives and
+	// /sitemap.xml. Sitemaps are fetched like pages, within robots.txt and
+	// each host's limits, and their pages are crawled as they are read.
+	// Pages only they reach, and the URLs found from those, are marked
+	// ViaSitemap.
+	SitemapSeeds bool
+
+	// HostRate is the maximum sustained requests per second to any one host.
+	// Zero means no limit.
+	HostRate float64
+	// HostBurst is the number of requests that may be made to a host at once
+	// before HostRate applies. Defaults to 1.
+	HostBurst int
+	// MaxPerHost is the maximum number of requests in flight to any one host,
+	// regardless of MaxCrawlers. Zero means no limit.
+	MaxPerHost int
+
+	// MaxRetries and MaxRetryTime limit the retries of each failed request,
+	// as for parse.Fetcher. When a host responds 429 or 503, requests to the
+	// whole host wait until the request is retried.
+	MaxRetries   int
+	MaxRetryTime time.Duration
+
+	// MaxDepth is the furthest click distance from a seed to crawl.
+	// Zero means no limit.
+	MaxDepth int
+	// MaxPages is the maximum number of URLs to fetch. Zero means no limit.
+	MaxPages int
+	// MaxBytes is the total number of body bytes after which no new fetches
+	// are started. Zero means no limit.
+	MaxBytes int64
+	// DrainTimeout is how long fetches in flight when Run's context is done
+	// may take to finish before they are aborted.
+	DrainTimeout time.Duration
+	// Pool, if set, is shared with other Crawlers, and limits this one in
+	// place of its own MaxCrawlers, HostRate, HostBurst and MaxPerHost.
+	// If nil, the Crawler has a Pool of its own.
+	Pool *Pool
+
+	// OnResource, if set, is called with each Resource as soon as it has been
+	// fetched, checked or skipped, so results can be streamed during a crawl.
+	// It is called from the goroutine running Run, one Resource at a time.
+	// Its Depth is lowered in the returned crawl if a shorter path to it is
+	// found later.
+	OnResource func(resource.Resource)
+}
+
+// A Crawler crawls outwards from a set of seed URLs.
+// Each Crawler holds its own state, so many may run in one process.
+type Crawler struct {
+	opts    Options
+	fetcher *parse.Fetcher
+	pool    *Pool
+
+	parses   chan resource.Resource
+	sitemaps chan sitemapList
+	crawled  map[url.URL]resource.Resource
+	// sitemapsRead records the sitemaps fetched, so each is read once.
+	sitemapsRead map[url.URL]bool
+	fetched      int
+	bytes        int64
+}
+
+// New returns a Crawler configured by opts.
+func New(opts Options) *Crawler {
+	if opts.MaxCrawlers <= 0 {
+		opts.MaxCrawlers = DefaultMaxCrawlers
+	}
+	seeds := make([]url.URL, len(opts.Seeds))
+	for i, s := range opts.Seeds {
+		seeds[i] = opts.Canonicalizer.URL(s)
+	}
+	opts.Seeds = seeds
+	if opts.InScope == nil {
+		opts.InScope = sameHostAs(opts.Seeds)
+	}
+	if opts.Excluded == nil {
+		opts.Excluded = func(url.URL) bool { return false }
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent
+	}
+	if opts.HostBurst <= 0 {
+		opts.HostBurst = 1
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = DefaultDrainTimeout
+	}
+	if opts.Pool == nil {
+		opts.Pool = NewPool(opts)
+	}
+	c := &Crawler{opts: opts, pool: opts.Pool}
+	c.fetcher = &parse.Fetcher{
+		Client:       opts.Client,
+		UserAgent:    opts.UserAgent,
+		MaxRetries:   opts.MaxRetries,
+		MaxRetryTime: opts.MaxRetryTime,
+		OnOverload: func(u url.URL, wait time.Duration) {
+			c.pool.hosts.get(u).pause(wait)
+		},
+		CheckRedirect: c.checkRedirect,
+	}
+	return c
+}
+
+// Run ranges over fetched Resources and spawns goroutines to fetch
+// previously-unseen URLs. It halts once no new URLs are discovered,
+// returning every Resource crawled keyed by its URL.
+//
+// If ctx is cancelled, no new fetches are started, and fetches in flight
+// have Options.DrainTimeout to finish before they are aborted. Run waits for
+// them and returns the partial crawl along with ctx.Err(). The crawl always
+// has the seeds, even those there was no time or budget to fetch.
+func (c *Crawler) Run(ctx context.Context) (map[url.URL]resource.Resource, error) {
+	c.parses = make(chan resource.Resource, c.opts.MaxCrawlers)
+	c.sitemaps = make(chan sitemapList, c.opts.MaxCrawlers)
+	c.crawled = make(map[url.URL]resource.Resource)
+	c.sitemapsRead = make(map[url.URL]bool)
+	c.fetched, c.bytes = 0, 0
+	drain, stop := drainContext(ctx, c.opts.DrainTimeout)
+	defer stop()
+
+	pending := 0
+	for _, s := range c.opts.Seeds {
+		if _, seen := c.crawled[s]; seen {
+			continue
+		}
+		if c.fetch(ctx, drain, s, 0, false, c.fetcher.Fetch) {
+			pending++
+		} else {
+			// Keep seeds that could not be fetched, so the crawl is named after its site.
+			c.crawled[s] = resource.Resource{URL: s, External: !c.opts.InScope(s), Error: errString(ctx.Err())}
+		}
+	}
+
+	if c.opts.SitemapSeeds && ctx.Err() == nil {
+		hosts := make(map[string]bool)
+		for _, s := range c.opts.Seeds {
+			if !hosts[s.Host] {
+				hosts[s.Host] = true
+				go c.findSitemaps(ctx, s)
+				pending++
+			}
+		}
+	}
+
+	for ; pending > 0; pending-- {
+		var r resource.Resource
+		select {
+		case r = <-c.parses:
+		case l := <-c.sitemaps:
+			pending += c.reachSitemap(ctx, drain, l)
+			continue
+		}
+		if r.RobotsDisallowed {
+			log.Printf("[Run] Skipped %s: disallowed by robots.txt\n", r.URL.String())
+		} else {
+			log.Printf("[Run] Crawled %s\n", r.URL.String())
+		}
+
+		c.canonicalize(&r)
+		r.Depth = c.crawled[r.URL].Depth
+		r.ViaSitemap = c.crawled[r.URL].ViaSitemap
+		r.External = !c.opts.InScope(r.URL)
+		c.crawled[r.URL] = r
+		c.markRedirectTarget(r)
+		c.bytes += r.Bytes
+		if c.opts.OnResource != nil {
+			c.opts.OnResource(r)
+		}
+
+		pending += c.expand(ctx, drain, r)
+	}
+
+	return c.crawled, ctx.Err()
+}
+
+// expand reaches the links and assets of r, one click further from the
+// seeds than r, unless that is beyond MaxDepth. It returns the number of
+// fetches started.
+func (c *Crawler) expand(ctx, drain context.Context, r resource.Resource) int {
+	// External resources are only checked, not crawled, but seeds are
+	// crawled even if out of scope.
+	if r.External && (r.Depth > 0 || r.ViaSitemap) {
+		return 0
+	}
+	depth := r.Depth + 1
+	if c.opts.MaxDepth > 0 && depth > c.opts.MaxDepth {
+		return 0
+	}
+	started := 0
+	for l := range r.Links {
+		started += c.reach(ctx, drain, l, depth, r.ViaSitemap, c.getter(l, false))
+	}
+	for a := range r.Assets {
+		started += c.reach(ctx, drain, a, depth, r.ViaSitemap, c.getter(a, true))
+	}
+	return started
+}
+
+// reach records that u was found at depth, via a sitemap or not. A new URL
+// is fetched with get, unless get is nil. A URL found further away before
+// has its depth lowered, and its links and assets are reached again, so
+// depths are the shortest click distance whichever fetch finishes first.
+// It returns the number of fetches started.
+func (c *Crawler) reach(ctx, drain context.Context, u url.URL, depth int, via bool, get getFunc) int {
+	r, seen := c.crawled[u]
+	switch {
+	case !seen:
+		if get != nil && c.fetch(ctx, drain, u, depth, via, get) {
+			return 1
+		}
+		return 0
+	case !nearer(depth, via, r):
+		return 0
+	}
+
+	r.Depth, r.ViaSitemap = depth, via
+	c.crawled[u] = r
+	// A Resource still being fetched has no links yet: it is expanded from
+	// its new depth once it arrives.
+	started := c.expand(ctx, drain, r)
+	if len(r.Redirects) > 0 {
+		started += c.reach(ctx, drain, c.opts.Canonicalizer.URL(r.FinalURL), depth, via, nil)
+	}
+	return started
+}
+
+// nearer reports whether finding a URL at depth, via a sitemap or not, is
+// a shorter path to it than r's. Paths from the seeds are shorter than any
+// via a sitemap.
+func nearer(depth int, via bool, r resource.Resource) bool {
+	if via != r.ViaSitemap {
+		return !via
+	}
+	return depth < r.Depth
+}
+
+// fetch fetches u, found at depth, with get in a new goroutine. It returns
+// false without fetching if ctx is done or the page or byte budget is
+// spent. Requests are made with drain, so they can finish once ctx is done.
+func (c *Crawler) fetch(ctx, drain context.Context, u url.URL, depth int, via bool, get getFunc) bool {
+	if ctx.Err() != nil || c.overBudget() {
+		return false
+	}
+	c.crawled[u] = resource.Resource{URL: u, Depth: depth, ViaSitemap: via}
+	c.fetched++
+	go c.visit(ctx, drain, u, func(ctx context.Context, done chan<- bool) {
+		get(ctx, u, c.parses, done)
+	}, func() {
+		c.parses <- resource.Resource{URL: u, RobotsDisallowed: true}
+	})
+	return true
+}
+
+// A getFunc fetches a URL, as parse.Fetcher's Fetch and Check do.
+type getFunc func(ctx context.Context, u url.URL, parses chan<- resource.Resource, done chan<- bool)
+
+// visit gets u with get once its host's robots.txt allows it, its host's
+// politeness limits and any Crawl-delay permit, and a crawler is free. get
+// must send true to done once its request is done. If robots.txt disallows
+// u, disallowed is called instead.
+func (c *Crawler) visit(ctx, drain context.Context, u url.URL, get func(ctx context.Context, done chan<- bool), disallowed func()) {
+	h := c.pool.hosts.get(u)
+	var delay time.Duration
+	if !c.opts.IgnoreRobots {
+		rules := c.robots(ctx, h, u)
+		if ctx.Err() == nil && !rules.Allowed(c.opts.UserAgent, u) {
+			disallowed()
+			return
+		}
+		delay = rules.CrawlDelay(c.opts.UserAgent)
+	}
+
+	// Wait for the host before taking a crawler, so a slow or throttled
+	// host cannot hold crawlers that requests to other hosts could use.
+	if h.acquire(ctx) == nil {
+		defer h.release()
+	}
+	h.wait(ctx, delay)
+	// If ctx is done, the request is not started: Fetch fails fast and
+	// reports u as usual.
+	done := c.pool.active
+	if !c.acquire(ctx) {
+		done = make(chan bool, 1)
+	}
+	if ctx.Err() != nil {
+		drain = ctx
+	}
+	get(drain, done)
+}
+
+// acquire waits for a free crawler, which must be returned to c.pool.active once
+// its request is done. It returns false without one if ctx is done first.
+func (c *Crawler) acquire(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-c.pool.active:
+		return true
+	}
+}
+
+// robots returns the robots.txt rules for the host of u, fetching them with
+// a free crawler on first use.
+func (c *Crawler) robots(ctx context.Context, h *host, u url.URL) *robots.Robots {
+	return h.rules(func() *robots.Robots {
+		if c.acquire(ctx) {
+			defer func() { c.pool.active <- true }()
+		}
+		// Redirects of robots.txt itself are not checked against robots.txt.
+		f := *c.fetcher
+		f.CheckRedirect = nil
+		return fetchRobots(ctx, &f, u)
+	})
+}
+
+// checkRedirect stops a redirect chain at u if it is excluded, or if
+// robots.txt disallows it. Only hops on the host first requested are
+// checked against robots.txt, as its rules are already known.
+func (c *Crawler) checkRedirect(ctx context.Context, u url.URL, via []resource.Redirect) error {
+	if c.opts.Excluded(c.opts.Canonicalizer.URL(u)) {
+		return errExcluded
+	}
+	if c.opts.IgnoreRobots || u.Host != via[0].URL.Host {
+		return nil
+	}
+	if !c.robots(ctx, c.pool.hosts.get(u), u).Allowed(c.opts.UserAgent, u) {
+		return parse.ErrRobotsDisallowed
+	}
+	return nil
+}
+
+// errString returns err's message, or "" if err is nil.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// drainContext returns a context for requests that is cancelled grace
+// after ctx is done, so requests in flight can finish. stop releases it.
+func drainContext(ctx context.Context, grace time.Duration) (drain context.Context, stop func()) {
+	drain, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopAfter := context.AfterFunc(ctx, func() {
+		time.AfterFunc(grace, cancel)
+	})
+	return drain, func() {
+		stopAfter()
+		cancel()
+	}
+}
+
+func (c *Crawler) overBudget() bool {
+	return (c.opts.MaxPages > 0 && c.fetched >= c.opts.MaxPages) ||
+		(c.opts.MaxBytes > 0 && c.bytes >= c.opts.MaxBytes)
+}
+
+// markRedirectTarget records the content of a redirected Resource under its
+// FinalURL too, so the target is not fetched again.
+func (c *Crawler) markRedirectTarget(r resource.Resource) {
+	if len(r.Redirects) == 0 {
+		return
+	}
+	final := c.opts.Canonicalizer.URL(r.FinalURL)
+	if _, seen := c.crawled[final]; seen || !c.opts.InScope(final) {
+		return
+	}
+	target := r
+	target.URL, target.Redirects = final, nil
+	c.crawled[final] = target
+}
+
+// canonicalize replaces the Links and Assets of r with their canonical forms.
+func (c *Crawler) canonicalize(r *resource.Resource) {
+	links := make(map[url.URL]bool, len(r.Links))
+	for l := range r.Links {
+		links[c.opts.Canonicalizer.URL(l)] = true
+	}
+	assets := make(map[url.URL]bool, len(r.Assets))
+	var elements map[url.URL]string
+	if r.Elements != nil {
+		elements = make(map[url.URL]string, len(r.Elements))
+	}
+	for a := range r.Assets {
+		ca := c.opts.Canonicalizer.URL(a)
+		assets[ca] = true
+		if e, ok := r.Elements[a]; ok && elements[ca] == "" {
+			elements[ca] = e
+		}
+	}
+	r.Links, r.Assets, r.Elements = links, assets, elements
+}
+
+// getter returns how to get u, a link or asset, or nil if it should not be
+// got. In-scope pages and stylesheets are fetched and parsed. Other assets,
+// and out-of-scope URLs, are only checked, if the Options ask for that.
+// URLs excluded by a rule are never got.
+func (c *Crawler) getter(u url.URL, asset bool) getFunc {
+	switch {
+	case c.shouldCrawl(u):
+		if !asset || isCSS(u) {
+			return c.fetcher.Fetch
+		}
+		if c.opts.CheckAssets {
+			return c.fetcher.Check
+		}
+	case c.opts.CheckExternal && !c.seen(u) && !c.opts.InScope(u) && !c.opts.Excluded(u):
+		return c.fetcher.Check
+	}
+	return nil
+}
+
+func (c *Crawler) seen(u url.URL) bool {
+	u.Fragment = ""
+	_, ok := c.crawled[u]
+	return ok
+}
+
+func (c *Crawler) shouldCrawl(u url.URL) bool {
+	return !c.seen(u) && c.opts.InScope(u)
+}
+
+// sameHostAs returns a scope function accepting URLs on the host of any seed.
+func sameHostAs(seeds []url.URL) func(url.URL) bool {
+	hosts := make(map[string]bool, len(seeds))
+	for _, s := range seeds {
+		hosts[s.Host] = true
+	}
+	return func(u url.URL) bool {
+		return hosts[u.Host]
+	}
+}
+
+func isCSS(url url.URL) bool {
+	return strings.HasSuffix(url.Path, ".css")
+}
@@ -0,0 +1,940 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/geotho/aragog/canonicalizer"
+	"github.com/geotho/aragog/resource"
+)
+
+func TestShouldCrawl(t *testing.T) {
+	c := New(Options{Seeds: []url.URL{parseURL("http://google.com")}})
+	initial := parseURL("http://google.com/cat.php")
+	c.crawled = map[url.URL]resource.Resource{initial: {}}
+
+	testCases := map[string]bool{
+		"http://google.com/cat.php":           false,
+		"http://amazon.com/cat.php":           false,
+		"http://google.com":                   true,
+		"http://google.com/":                  true,
+		"http://google.com/cat.php?args":      true,
+		"http://google.com/cat.php#fragment":  false,
+		"https://google.com/cat.php":          true,
+		"https://google.com/cat.php#fragment": true,
+	}
+
+	for k, v := range testCases {
+		if actual := c.shouldCrawl(parseURL(k)); actual != v {
+			t.Errorf("%s: Expected %v, got %v", k, v, actual)
+		}
+	}
+}
+
+func TestCrawlersAreIndependent(t *testing.T) {
+	a := New(Options{Seeds: []url.URL{parseURL("http://google.com")}})
+	b := New(Options{Seeds: []url.URL{parseURL("http://amazon.com")}})
+	a.crawled = map[url.URL]resource.Resource{}
+	b.crawled = map[url.URL]resource.Resource{}
+
+	if !a.shouldCrawl(parseURL("http://google.com/")) || a.shouldCrawl(parseURL("http://amazon.com/")) {
+		t.Errorf("crawler a should only crawl google.com")
+	}
+	if !b.shouldCrawl(parseURL("http://amazon.com/")) || b.shouldCrawl(parseURL("http://google.com/")) {
+		t.Errorf("crawler b should only crawl amazon.com")
+	}
+}
+
+func TestRun(t *testing.T) {
+	ts := httptest.NewServer(testSite(map[string]string{
+		"/":          `<a href="/a">a</a><a href="/b#top">b</a><link rel="stylesheet" href="/s.css">`,
+		"/a":         `<a href="/">home</a><a href="http://elsewhere.invalid/">away</a>`,
+		"/b":         `<img src="/cat.png">`,
+		"/s.css":     `body { background: url("/bg.png"); }`,
+		"/cat.png":   ``,
+		"/bg.png":    ``,
+		"/never.htm": ``,
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}, MaxCrawlers: 2}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, p := range []string{"/", "/a", "/b", "/s.css"} {
+		r, ok := crawled[parseURL(ts.URL+p)]
+		if !ok {
+			t.Errorf("%s was not crawled", p)
+			continue
+		}
+		if r.URL != parseURL(ts.URL+p) {
+			t.Errorf("%s: Expected URL %s, got %s", p, ts.URL+p, r.URL.String())
+		}
+	}
+	if len(crawled) != 4 {
+		t.Errorf("Expected 4 resources, got %d", len(crawled))
+	}
+	if !crawled[parseURL(ts.URL+"/s.css")].Assets[parseURL(ts.URL+"/bg.png")] {
+		t.Errorf("Expected stylesheet assets to be parsed")
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	site := testSite(map[string]string{
+		"/": `<a href="/slow">slow</a>`,
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	crawled, err := New(Options{
+		Seeds:        []url.URL{parseURL(ts.URL + "/")},
+		DrainTimeout: 100 * time.Millisecond,
+	}).Run(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected %s, got %v", context.DeadlineExceeded, err)
+	}
+	if !crawled[parseURL(ts.URL+"/")].Links[parseURL(ts.URL+"/slow")] {
+		t.Errorf("Expected partial crawl to keep pages crawled before the deadline")
+	}
+	if r, ok := crawled[parseURL(ts.URL+"/slow")]; !ok || r.Error == "" {
+		t.Errorf("Expected in-flight fetch to be aborted after the drain timeout and kept in the crawl")
+	}
+}
+
+func TestRunCancelledBeforeStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	seed := parseURL("http://google.com/")
+	crawled, err := New(Options{Seeds: []url.URL{seed}}).Run(ctx)
+	if err != context.Canceled {
+		t.Errorf("Expected %s, got %v", context.Canceled, err)
+	}
+	if r, ok := crawled[seed]; !ok || r.Error != context.Canceled.Error() {
+		t.Errorf("Expected the unfetched seed to be kept in the crawl, got %+v", r)
+	}
+}
+
+func TestRunDrains(t *testing.T) {
+	site := testSite(map[string]string{
+		"/":     `<a href="/slow">slow</a>`,
+		"/slow": `<a href="/never">never</a>`,
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	crawled, err := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}}).Run(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected %s, got %v", context.DeadlineExceeded, err)
+	}
+	if r := crawled[parseURL(ts.URL+"/slow")]; r.Status != http.StatusOK || r.Error != "" {
+		t.Errorf("Expected in-flight fetch to finish after the deadline, got status %d, error %q", r.Status, r.Error)
+	}
+	if _, ok := crawled[parseURL(ts.URL+"/never")]; ok {
+		t.Errorf("Expected no new fetches after the deadline")
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	ts := httptest.NewServer(testSite(map[string]string{
+		"/":  `<a href="/1">1</a>`,
+		"/1": `<a href="/2">2</a>`,
+		"/2": `<a href="/3">3</a>`,
+		"/3": `the end`,
+	}))
+	defer ts.Close()
+
+	testCases := map[string]struct {
+		opts     Options
+		expected []string
+	}{
+		"no limit":  {Options{}, []string{"/", "/1", "/2", "/3"}},
+		"max depth": {Options{MaxDepth: 2}, []string{"/", "/1", "/2"}},
+		"max pages": {Options{MaxPages: 3}, []string{"/", "/1", "/2"}},
+		"max bytes": {Options{MaxBytes: 1}, []string{"/"}},
+	}
+
+	for name, tc := range testCases {
+		tc.opts.Seeds = []url.URL{parseURL(ts.URL + "/")}
+		crawled, err := New(tc.opts).Run(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %s", name, err)
+		}
+		if len(crawled) != len(tc.expected) {
+			t.Errorf("%s: Expected %d resources, got %d", name, len(tc.expected), len(crawled))
+		}
+		for depth, p := range tc.expected {
+			if r, ok := crawled[parseURL(ts.URL+p)]; !ok || r.Depth != depth {
+				t.Errorf("%s: Expected %s at depth %d, got %v at %d", name, p, depth, ok, r.Depth)
+			}
+		}
+	}
+}
+
+func TestRunShortestDepth(t *testing.T) {
+	site := testSite(map[string]string{
+		"/":       `<a href="/a">a</a><a href="/slow">slow</a>`,
+		"/a":      `<a href="/a2">a2</a>`,
+		"/a2":     `<a href="/a3">a3</a>`,
+		"/a3":     `<a href="/target">target</a>`,
+		"/slow":   `<a href="/target">target</a>`,
+		"/target": `<a href="/child">child</a>`,
+		"/child":  `the end`,
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			// Let the long path find /target first.
+			time.Sleep(300 * time.Millisecond)
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}, MaxDepth: 4}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := map[string]int{"/": 0, "/a": 1, "/slow": 1, "/a2": 2, "/target": 2, "/a3": 3, "/child": 3}
+	if len(crawled) != len(expected) {
+		t.Errorf("Expected %d resources, got %d", len(expected), len(crawled))
+	}
+	for p, depth := range expected {
+		if r, ok := crawled[parseURL(ts.URL+p)]; !ok || r.Depth != depth {
+			t.Errorf("Expected %s at depth %d, got %v at %d", p, depth, ok, r.Depth)
+		}
+	}
+}
+
+func TestRunRobots(t *testing.T) {
+	var fetchedPrivate atomic.Bool
+	site := testSite(map[string]string{
+		"/":           `<a href="/private/">private</a><a href="/public">public</a>`,
+		"/public":     `hello`,
+		"/robots.txt": "User-agent: *\nDisallow: /\n\nUser-agent: aragog\nDisallow: /private/\n",
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/private/" {
+			fetchedPrivate.Store(true)
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}, MaxCrawlers: 1}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if fetchedPrivate.Load() {
+		t.Errorf("Expected /private/ not to be fetched")
+	}
+	if !crawled[parseURL(ts.URL+"/private/")].RobotsDisallowed {
+		t.Errorf("Expected /private/ to be recorded as disallowed by robots.txt")
+	}
+	if r := crawled[parseURL(ts.URL+"/public")]; r.RobotsDisallowed || r.Bytes == 0 {
+		t.Errorf("Expected /public to be crawled")
+	}
+
+	crawled, err = New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}, IgnoreRobots: true}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !fetchedPrivate.Load() || crawled[parseURL(ts.URL+"/private/")].RobotsDisallowed {
+		t.Errorf("Expected /private/ to be fetched when ignoring robots.txt")
+	}
+}
+
+func TestRunRobotsRedirect(t *testing.T) {
+	var fetchedPrivate atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+		case "/":
+			fmt.Fprint(w, `<a href="/go">go</a>`)
+		case "/go":
+			http.Redirect(w, r, "/private/page", http.StatusFound)
+		case "/private/page":
+			fetchedPrivate.Store(true)
+		}
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if fetchedPrivate.Load() {
+		t.Errorf("Expected a redirect to a disallowed path not to be followed")
+	}
+	if r := crawled[parseURL(ts.URL+"/go")]; !r.RobotsDisallowed || r.Error != "" {
+		t.Errorf("Expected /go to be recorded as disallowed by robots.txt, got %+v", r)
+	}
+}
+
+func TestRunExcludedRedirect(t *testing.T) {
+	var logouts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/account">account</a>`)
+		case "/account":
+			http.Redirect(w, r, "/logout", http.StatusFound)
+		case "/logout":
+			atomic.AddInt32(&logouts, 1)
+		}
+	}))
+	defer ts.Close()
+
+	excluded := func(u url.URL) bool { return u.Path == "/logout" }
+	crawled, err := New(Options{
+		Seeds:    []url.URL{parseURL(ts.URL + "/")},
+		InScope:  func(u url.URL) bool { return !excluded(u) },
+		Excluded: excluded,
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if n := atomic.LoadInt32(&logouts); n != 0 {
+		t.Errorf("Expected a redirect to an excluded URL not to be followed, got %d requests", n)
+	}
+	if r := crawled[parseURL(ts.URL+"/account")]; !strings.Contains(r.Error, errExcluded.Error()) {
+		t.Errorf("Expected /account to stop at the excluded hop, got %+v", r)
+	}
+	if _, ok := crawled[parseURL(ts.URL+"/logout")]; ok {
+		t.Errorf("Expected excluded URL not to be recorded")
+	}
+}
+
+func TestHostWait(t *testing.T) {
+	h := &host{}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := h.wait(context.Background(), 50*time.Millisecond); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected requests to be spaced by the delay, took %s", elapsed)
+	}
+}
+
+func TestHostRateLimit(t *testing.T) {
+	h := (&hosts{rate: 20, burst: 2}).get(parseURL("http://google.com/"))
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := h.wait(context.Background(), 0); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	// Two requests burst, then two more wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected about 100ms of rate limiting, took %s", elapsed)
+	}
+}
+
+func TestHostPause(t *testing.T) {
+	h := &host{}
+	h.pause(100 * time.Millisecond)
+	start := time.Now()
+	if err := h.wait(context.Background(), 0); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected requests to wait for the pause, took %s", elapsed)
+	}
+}
+
+func TestRunMaxPerHost(t *testing.T) {
+	var inFlight, maxInFlight int32
+	site := testSite(map[string]string{
+		"/":  `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a>`,
+		"/1": ``, "/2": ``, "/3": ``, "/4": ``,
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{
+		Seeds:        []url.URL{parseURL(ts.URL + "/")},
+		MaxCrawlers:  10,
+		MaxPerHost:   2,
+		IgnoreRobots: true,
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(crawled) != 5 {
+		t.Errorf("Expected 5 resources, got %d", len(crawled))
+	}
+	if atomic.LoadInt32(&maxInFlight) > 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", maxInFlight)
+	}
+}
+
+func TestRunSharedPool(t *testing.T) {
+	var inFlight, maxInFlight int32
+	handler := func(site http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				m := atomic.LoadInt32(&maxInFlight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			site.ServeHTTP(w, r)
+		})
+	}
+	pages := map[string]string{
+		"/":  `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a>`,
+		"/1": ``, "/2": ``, "/3": ``,
+	}
+	a := httptest.NewServer(handler(testSite(pages)))
+	defer a.Close()
+	b := httptest.NewServer(handler(testSite(pages)))
+	defer b.Close()
+
+	pool := NewPool(Options{MaxCrawlers: 2})
+	crawls := make(chan map[url.URL]resource.Resource, 2)
+	for _, ts := range []*httptest.Server{a, b} {
+		c := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}, MaxCrawlers: 2, Pool: pool})
+		go func() {
+			crawled, err := c.Run(context.Background())
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			crawls <- crawled
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if crawled := <-crawls; len(crawled) != 4 {
+			t.Errorf("Expected 4 resources, got %d", len(crawled))
+		}
+	}
+	if n := atomic.LoadInt32(&maxInFlight); n > 2 {
+		t.Errorf("Expected at most 2 requests in flight across both crawlers, got %d", n)
+	}
+}
+
+func TestRunHostLimitsAreIndependent(t *testing.T) {
+	slowSite := testSite(map[string]string{
+		"/":  `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a>`,
+		"/1": ``, "/2": ``, "/3": ``, "/4": ``,
+	})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		slowSite.ServeHTTP(w, r)
+	}))
+	defer slow.Close()
+	fastSite := testSite(map[string]string{
+		"/":  `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a>`,
+		"/1": ``, "/2": ``, "/3": ``, "/4": ``,
+	})
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			// Let the slow host's links queue up first.
+			time.Sleep(300 * time.Millisecond)
+		}
+		fastSite.ServeHTTP(w, r)
+	}))
+	defer fast.Close()
+
+	start := time.Now()
+	var fastDone time.Duration
+	fastHost := parseURL(fast.URL).Host
+	fastCrawled := 0
+	_, err := New(Options{
+		Seeds:        []url.URL{parseURL(slow.URL + "/"), parseURL(fast.URL + "/")},
+		MaxCrawlers:  2,
+		MaxPerHost:   1,
+		IgnoreRobots: true,
+		OnResource: func(r resource.Resource) {
+			if r.URL.Host == fastHost {
+				if fastCrawled++; fastCrawled == 5 {
+					fastDone = time.Since(start)
+				}
+			}
+		},
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	// The slow host takes 1s; its queued requests must not hold both crawlers.
+	if fastDone == 0 || fastDone > 700*time.Millisecond {
+		t.Errorf("Expected the fast host to be crawled while the slow host waits, took %s", fastDone)
+	}
+}
+
+func TestRunRedirects(t *testing.T) {
+	site := testSite(map[string]string{
+		"/":    `<a href="/old">old</a>`,
+		"/new": `<a href="/">home</a><a href="/new">self</a>`,
+	})
+	var newFetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		case "/new":
+			atomic.AddInt32(&newFetches, 1)
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	old := crawled[parseURL(ts.URL+"/old")]
+	if old.FinalURL != parseURL(ts.URL+"/new") || len(old.Redirects) != 1 {
+		t.Errorf("Expected /old to redirect to /new, got %s via %v", old.FinalURL.String(), old.Redirects)
+	}
+	if r, ok := crawled[parseURL(ts.URL+"/new")]; !ok || !r.Links[parseURL(ts.URL+"/")] {
+		t.Errorf("Expected redirect target /new to be recorded")
+	}
+	if n := atomic.LoadInt32(&newFetches); n != 1 {
+		t.Errorf("Expected /new to be fetched once, got %d", n)
+	}
+}
+
+func TestRunCheckAssets(t *testing.T) {
+	var heads int32
+	site := testSite(map[string]string{
+		"/":        `<html><img src="/cat.png"><img src="/missing.png"></html>`,
+		"/cat.png": `not really a png`,
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt32(&heads, 1)
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}, CheckAssets: true}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if s := crawled[parseURL(ts.URL+"/cat.png")].Status; s != http.StatusOK {
+		t.Errorf("Expected /cat.png to be 200, got %d", s)
+	}
+	if s := crawled[parseURL(ts.URL+"/missing.png")].Status; s != http.StatusNotFound {
+		t.Errorf("Expected /missing.png to be 404, got %d", s)
+	}
+	if n := atomic.LoadInt32(&heads); n != 2 {
+		t.Errorf("Expected assets to be checked with 2 HEAD requests, got %d", n)
+	}
+}
+
+func TestRunCheckExternal(t *testing.T) {
+	var requests int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&requests, 1)
+		if r.Method != http.MethodHead {
+			t.Errorf("Expected external URLs to be checked with HEAD, got %s", r.Method)
+		}
+		fmt.Fprint(w, `<a href="/deeper">deeper</a>`)
+	}))
+	defer other.Close()
+
+	ts := httptest.NewServer(testSite(map[string]string{
+		"/":  `<a href="` + other.URL + `/page">out</a><a href="/b">b</a><img src="` + other.URL + `/page">`,
+		"/b": `<a href="` + other.URL + `/page">out again</a>`,
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}, CheckExternal: true}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	external := crawled[parseURL(other.URL+"/page")]
+	if !external.External || external.Status != http.StatusOK {
+		t.Errorf("Expected external page to be checked and marked external, got %+v", external)
+	}
+	if crawled[parseURL(ts.URL+"/b")].External {
+		t.Errorf("Expected /b not to be marked external")
+	}
+	if _, ok := crawled[parseURL(other.URL+"/deeper")]; ok {
+		t.Errorf("Expected external page not to be crawled")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected external page to be checked once, got %d requests", n)
+	}
+}
+
+func TestRunCheckExternalHeadNotAllowed(t *testing.T) {
+	var deeper int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.URL.Path == "/start":
+			fmt.Fprint(w, `<a href="/deeper">deeper</a><a href="/deeper2">deeper2</a>`)
+		case r.URL.Path != "/robots.txt":
+			atomic.AddInt32(&deeper, 1)
+		}
+	}))
+	defer other.Close()
+
+	ts := httptest.NewServer(testSite(map[string]string{
+		"/": `<a href="` + other.URL + `/start">out</a>`,
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{Seeds: []url.URL{parseURL(ts.URL + "/")}, CheckExternal: true}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	external := crawled[parseURL(other.URL+"/start")]
+	if !external.External || external.Status != http.StatusOK || len(external.Links) > 0 {
+		t.Errorf("Expected external page to be checked with GET but not parsed, got %+v", external)
+	}
+	for _, path := range []string{"/deeper", "/deeper2"} {
+		if _, ok := crawled[parseURL(other.URL+path)]; ok {
+			t.Errorf("Expected %s not to be reached", path)
+		}
+	}
+	if n := atomic.LoadInt32(&deeper); n != 0 {
+		t.Errorf("Expected links of external page not to be requested, got %d requests", n)
+	}
+}
+
+func TestRunCheckExternalSkipsExcluded(t *testing.T) {
+	var logouts int32
+	site := testSite(map[string]string{
+		"/":       `<a href="/logout">log out</a><a href="/b">b</a>`,
+		"/b":      `b`,
+		"/logout": `logged out`,
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logout" {
+			atomic.AddInt32(&logouts, 1)
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	excluded := func(u url.URL) bool { return u.Path == "/logout" }
+	crawled, err := New(Options{
+		Seeds:         []url.URL{parseURL(ts.URL + "/")},
+		InScope:       func(u url.URL) bool { return !excluded(u) },
+		Excluded:      excluded,
+		CheckExternal: true,
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if n := atomic.LoadInt32(&logouts); n != 0 {
+		t.Errorf("Expected excluded URL never to be requested, got %d requests", n)
+	}
+	if r, ok := crawled[parseURL(ts.URL+"/logout")]; ok {
+		t.Errorf("Expected excluded URL not to be recorded, got %+v", r)
+	}
+	if _, ok := crawled[parseURL(ts.URL+"/b")]; !ok {
+		t.Errorf("Expected /b to be crawled")
+	}
+}
+
+func TestRunOnResource(t *testing.T) {
+	ts := httptest.NewServer(testSite(map[string]string{
+		"/":  `<a href="/b">b</a>`,
+		"/b": `<a href="/">home</a>`,
+	}))
+	defer ts.Close()
+
+	var streamed []resource.Resource
+	crawled, err := New(Options{
+		Seeds:      []url.URL{parseURL(ts.URL + "/")},
+		OnResource: func(r resource.Resource) { streamed = append(streamed, r) },
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(streamed) != len(crawled) {
+		t.Fatalf("Expected %d Resources to be streamed, got %d", len(crawled), len(streamed))
+	}
+	for _, r := range streamed {
+		if r.Status != crawled[r.URL].Status || r.Depth != crawled[r.URL].Depth {
+			t.Errorf("Expected streamed %s to match crawled", r.URL.String())
+		}
+	}
+}
+
+func TestRunCanonicalizer(t *testing.T) {
+	ts := httptest.NewServer(testSite(map[string]string{
+		"/":           `<a href="/index.html">home</a><a href="/?utm_source=x">home</a><a href="/a/../b?y=2&x=1">b</a>`,
+		"/index.html": `<a href="/">home</a>`,
+		"/b":          `<a href="/b?x=1&y=2">b</a>`,
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{
+		Seeds:         []url.URL{parseURL(ts.URL)},
+		Canonicalizer: canonicalizer.Default(),
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []string{ts.URL + "/", ts.URL + "/b?x=1&y=2"}
+	if len(crawled) != len(expected) {
+		t.Errorf("Expected %d URLs to be crawled, got %d: %v", len(expected), len(crawled), crawled)
+	}
+	for _, e := range expected {
+		if _, ok := crawled[parseURL(e)]; !ok {
+			t.Errorf("Expected %s to be crawled", e)
+		}
+	}
+	if links := crawled[parseURL(ts.URL+"/")].Links; len(links) != 2 {
+		t.Errorf("Expected the links of / to be canonicalized to 2 URLs, got %v", links)
+	}
+}
+
+func TestRunSitemapSeeds(t *testing.T) {
+	var ts *httptest.Server
+	site := testSite(map[string]string{
+		"/":             `<a href="/a">a</a>`,
+		"/a":            `<a href="/">home</a>`,
+		"/orphan":       `<a href="/orphan-child">child</a>`,
+		"/orphan-child": `<a href="/">home</a>`,
+		"/other-orphan": `<a href="/a">a</a>`,
+	})
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "Sitemap: %s/index.xml\n", ts.URL)
+		case "/index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/sitemap-1.xml.gz</loc></sitemap></sitemapindex>`, ts.URL)
+		case "/sitemap-1.xml.gz":
+			gz := gzip.NewWriter(w)
+			fmt.Fprintf(gz, `<urlset><url><loc>%s/</loc></url><url><loc>%s/orphan</loc></url></urlset>`, ts.URL, ts.URL)
+			gz.Close()
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/other-orphan</loc></url></urlset>`, ts.URL)
+		default:
+			site.ServeHTTP(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{
+		Seeds:        []url.URL{parseURL(ts.URL + "/")},
+		SitemapSeeds: true,
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := map[string]bool{
+		"/":             false,
+		"/a":            false,
+		"/orphan":       true,
+		"/orphan-child": true,
+		"/other-orphan": true,
+	}
+	if len(crawled) != len(expected) {
+		t.Errorf("Expected %d URLs to be crawled, got %d", len(expected), len(crawled))
+	}
+	for path, via := range expected {
+		r, ok := crawled[parseURL(ts.URL+path)]
+		if !ok {
+			t.Errorf("Expected %s to be crawled", path)
+		} else if r.ViaSitemap != via {
+			t.Errorf("%s: Expected ViaSitemap %v, got %v", path, via, r.ViaSitemap)
+		}
+	}
+}
+
+func TestRunSitemapSeedsObeyHostLimits(t *testing.T) {
+	var inFlight, maxInFlight, private int32
+	var ts *httptest.Server
+	site := testSite(map[string]string{
+		"/":       `<a href="/a">a</a>`,
+		"/a":      ``,
+		"/orphan": ``,
+	})
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private/\nSitemap: %s/private/sitemap.xml\nSitemap: %s/sitemap-1.xml\n", ts.URL, ts.URL)
+			return
+		}
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		switch r.URL.Path {
+		case "/private/sitemap.xml":
+			atomic.AddInt32(&private, 1)
+			fmt.Fprintf(w, `<urlset><url><loc>%s/private/page</loc></url></urlset>`, ts.URL)
+		case "/sitemap-1.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/orphan</loc></url></urlset>`, ts.URL)
+		default:
+			site.ServeHTTP(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{
+		Seeds:        []url.URL{parseURL(ts.URL + "/")},
+		MaxCrawlers:  10,
+		MaxPerHost:   1,
+		SitemapSeeds: true,
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if r, ok := crawled[parseURL(ts.URL+"/orphan")]; !ok || !r.ViaSitemap {
+		t.Errorf("Expected /orphan to be crawled via the sitemap, got %+v", r)
+	}
+	if n := atomic.LoadInt32(&private); n != 0 {
+		t.Errorf("Expected a sitemap disallowed by robots.txt not to be fetched, got %d requests", n)
+	}
+	if _, ok := crawled[parseURL(ts.URL+"/private/page")]; ok {
+		t.Errorf("Expected the disallowed sitemap's pages not to be crawled")
+	}
+	if n := atomic.LoadInt32(&maxInFlight); n > 1 {
+		t.Errorf("Expected at most 1 request in flight, sitemaps included, got %d", n)
+	}
+}
+
+func TestRunSitemapSeedsDuringLinks(t *testing.T) {
+	var slowDone, orphanEarly int32
+	var ts *httptest.Server
+	site := testSite(map[string]string{
+		"/":       `<a href="/slow">slow</a>`,
+		"/orphan": ``,
+	})
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(300 * time.Millisecond)
+			atomic.StoreInt32(&slowDone, 1)
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/orphan</loc></url></urlset>`, ts.URL)
+			return
+		case "/orphan":
+			if atomic.LoadInt32(&slowDone) == 0 {
+				atomic.StoreInt32(&orphanEarly, 1)
+			}
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	crawled, err := New(Options{
+		Seeds:        []url.URL{parseURL(ts.URL + "/")},
+		SitemapSeeds: true,
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, ok := crawled[parseURL(ts.URL+"/orphan")]; !ok {
+		t.Fatalf("Expected /orphan to be crawled")
+	}
+	if atomic.LoadInt32(&orphanEarly) == 0 {
+		t.Errorf("Expected the sitemap's pages to be crawled while links were still being followed")
+	}
+}
+
+func TestReadSitemaps(t *testing.T) {
+	var private int32
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/sitemap-1.xml</loc></sitemap><sitemap><loc>%s/private/sitemap.xml</loc></sitemap></sitemapindex>`, ts.URL, ts.URL)
+		case "/sitemap-1.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/a</loc></url><url><loc>%s/b</loc></url></urlset>`, ts.URL, ts.URL)
+		case "/private/sitemap.xml":
+			atomic.AddInt32(&private, 1)
+			fmt.Fprintf(w, `<urlset><url><loc>%s/private/page</loc></url></urlset>`, ts.URL)
+		}
+	}))
+	defer ts.Close()
+
+	pages, err := New(Options{}).ReadSitemaps(context.Background(), []url.URL{parseURL(ts.URL + "/sitemap.xml")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(pages) != 2 || pages[0] != parseURL(ts.URL+"/a") || pages[1] != parseURL(ts.URL+"/b") {
+		t.Errorf("Expected the pages of the allowed sitemap, got %v", pages)
+	}
+	if n := atomic.LoadInt32(&private); n != 0 {
+		t.Errorf("Expected a sitemap disallowed by robots.txt not to be fetched, got %d requests", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New(Options{}).ReadSitemaps(ctx, []url.URL{parseURL(ts.URL + "/sitemap.xml")}); err != context.Canceled {
+		t.Errorf("Expected a cancelled read to return context.Canceled, got %v", err)
+	}
+}
+
+// testSite serves pages as HTML from a map of path to body.
+func testSite(pages map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	})
+}
+
+func parseURL(s string) url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return *u
+}
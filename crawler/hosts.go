@@ -0,0 +1,158 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/geotho/aragog/parse"
+	"github.com/geotho/aragog/robots"
+)
+
+// A host holds the per-host state shared by all fetches to that host.
+type host struct {
+	robotsOnce sync.Once
+	robots     *robots.Robots
+
+	// slots limits the requests in flight to the host. It is nil if unlimited.
+	slots chan bool
+
+	mu   sync.Mutex
+	next time.Time // earliest time the next request may start
+
+	// A token bucket refilled at rate tokens per second up to burst.
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// hosts lazily creates the state for each host. It is safe for concurrent use.
+type hosts struct {
+	// rate, burst and maxInFlight configure each new host.
+	rate        float64
+	burst       int
+	maxInFlight int
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+func (hs *hosts) get(u url.URL) *host {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.hosts == nil {
+		hs.hosts = make(map[string]*host)
+	}
+	h, ok := hs.hosts[u.Host]
+	if !ok {
+		h = &host{rate: hs.rate, burst: float64(hs.burst), tokens: float64(hs.burst), last: time.Now()}
+		if hs.maxInFlight > 0 {
+			h.slots = make(chan bool, hs.maxInFlight)
+		}
+		hs.hosts[u.Host] = h
+	}
+	return h
+}
+
+// rules returns the host's robots.txt rules, getting them with fetch on first use.
+func (h *host) rules(fetch func() *robots.Robots) *robots.Robots {
+	h.robotsOnce.Do(func() {
+		h.robots = fetch()
+	})
+	return h.robots
+}
+
+// acquire blocks until fewer than the maximum requests are in flight to
+// the host. If it returns nil, release must be called once the request is done.
+func (h *host) acquire(ctx context.Context) error {
+	if h.slots == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case h.slots <- true:
+		return nil
+	}
+}
+
+func (h *host) release() {
+	if h.slots != nil {
+		<-h.slots
+	}
+}
+
+// pause stops new requests to the host for d, e.g. because it is overloaded.
+func (h *host) pause(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if until := time.Now().Add(d); until.After(h.next) {
+		h.next = until
+	}
+}
+
+// wait blocks until the host's rate limit allows a request, and at least
+// delay has passed since the last request. It returns early with an error
+// if ctx is done.
+func (h *host) wait(ctx context.Context, delay time.Duration) error {
+	h.mu.Lock()
+	now := time.Now()
+	start := now
+	if h.rate > 0 {
+		h.tokens += now.Sub(h.last).Seconds() * h.rate
+		if h.tokens > h.burst {
+			h.tokens = h.burst
+		}
+		h.last = now
+		// Going into debt reserves a future token.
+		h.tokens--
+		if h.tokens < 0 {
+			start = now.Add(time.Duration(-h.tokens / h.rate * float64(time.Second)))
+		}
+	}
+	if h.next.After(start) {
+		start = h.next
+	}
+	h.next = start.Add(delay)
+	h.mu.Unlock()
+
+	t := time.NewTimer(start.Sub(now))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// fetchRobots fetches and parses /robots.txt for the host of u.
+// A missing robots.txt allows everything. As RFC 9309 requires, an
+// unreachable one disallows everything.
+func fetchRobots(ctx context.Context, f *parse.Fetcher, u url.URL) *robots.Robots {
+	robotsURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	resp, _, _, err := f.Follow(ctx, robotsURL)
+	if err != nil {
+		log.Printf("[fetchRobots] %s: %s\n", robotsURL.String(), err.Error())
+		return robots.DisallowAll()
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		log.Printf("[fetchRobots] %s: %s\n", robotsURL.String(), resp.Status)
+		return robots.DisallowAll()
+	case resp.StatusCode >= http.StatusBadRequest:
+		return nil
+	}
+
+	r, err := robots.Parse(resp.Body)
+	if err != nil {
+		log.Printf("[fetchRobots] %s: %s\n", robotsURL.String(), err.Error())
+	}
+	return r
+}
@@ -0,0 +1,30 @@
+package crawler
+
+// A Pool limits the fetches of one or more Crawlers running at once: to
+// MaxCrawlers in flight in all, and by each host's politeness limits and
+// Crawl-delay across all of them. Each host's robots.txt is fetched once
+// for the whole Pool. It is safe for concurrent use.
+type Pool struct {
+	// active holds a token for each free crawler.
+	active chan bool
+	hosts  hosts
+}
+
+// NewPool returns a Pool limited by the MaxCrawlers, HostRate, HostBurst
+// and MaxPerHost of opts, defaulted as for New.
+func NewPool(opts Options) *Pool {
+	if opts.MaxCrawlers <= 0 {
+		opts.MaxCrawlers = DefaultMaxCrawlers
+	}
+	if opts.HostBurst <= 0 {
+		opts.HostBurst = 1
+	}
+	p := &Pool{
+		active: make(chan bool, opts.MaxCrawlers),
+		hosts:  hosts{rate: opts.HostRate, burst: opts.HostBurst, maxInFlight: opts.MaxPerHost},
+	}
+	for i := 0; i < opts.MaxCrawlers; i++ {
+		p.active <- true
+	}
+	return p
+}
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"net/url"
+
+	"github.com/geotho/aragog/parse"
+)
+
+// A sitemapList is what a sitemap lists: pages, or other sitemaps if it is
+// a sitemap index.
+type sitemapList struct {
+	pages, sitemaps []url.URL
+}
+
+// findSitemaps sends the sitemaps of the host of seed to c.sitemaps: those
+// named by its robots.txt Sitemap: directives, and /sitemap.xml.
+func (c *Crawler) findSitemaps(ctx context.Context, seed url.URL) {
+	var sitemaps []url.URL
+	if rules := c.robots(ctx, c.pool.hosts.get(seed), seed); rules != nil {
+		for _, sitemap := range rules.Sitemaps {
+			if u, err := url.Parse(sitemap); err == nil && u.IsAbs() {
+				sitemaps = append(sitemaps, *u)
+			}
+		}
+	}
+	sitemaps = append(sitemaps, url.URL{Scheme: seed.Scheme, Host: seed.Host, Path: "/sitemap.xml"})
+	c.sitemaps <- sitemapList{sitemaps: sitemaps}
+}
+
+// ReadSitemaps returns the pages listed in the sitemaps at urls, following
+// sitemap indexes. Sitemaps are fetched like pages, within the limits of
+// the Crawler's Pool and robots.txt, and at most parse.MaxSitemaps are
+// read. If ctx is done first, it returns the pages read so far along with
+// ctx.Err(). It must not be called while Run is.
+func (c *Crawler) ReadSitemaps(ctx context.Context, urls []url.URL) ([]url.URL, error) {
+	c.sitemaps = make(chan sitemapList, c.opts.MaxCrawlers)
+	c.sitemapsRead = make(map[url.URL]bool)
+	drain, stop := drainContext(ctx, c.opts.DrainTimeout)
+	defer stop()
+
+	var pages []url.URL
+	pending := 0
+	for _, u := range urls {
+		pending += c.readSitemap(ctx, drain, u)
+	}
+	for ; pending > 0; pending-- {
+		l := <-c.sitemaps
+		pages = append(pages, l.pages...)
+		for _, u := range l.sitemaps {
+			pending += c.readSitemap(ctx, drain, u)
+		}
+	}
+	return pages, ctx.Err()
+}
+
+// readSitemap fetches the sitemap at u in a new goroutine, as for a page,
+// unless it was read before, parse.MaxSitemaps have been, or ctx is done.
+// It returns the number of fetches started.
+func (c *Crawler) readSitemap(ctx, drain context.Context, u url.URL) int {
+	if c.sitemapsRead[u] || len(c.sitemapsRead) >= parse.MaxSitemaps || ctx.Err() != nil {
+		return 0
+	}
+	c.sitemapsRead[u] = true
+	go c.visit(ctx, drain, u, func(ctx context.Context, done chan<- bool) {
+		pages, sitemaps, err := c.fetcher.FetchSitemap(ctx, u)
+		done <- true
+		if err != nil {
+			log.Printf("[readSitemap] %s: %s\n", u.String(), err.Error())
+		}
+		c.sitemaps <- sitemapList{pages: pages, sitemaps: sitemaps}
+	}, func() {
+		c.sitemaps <- sitemapList{}
+	})
+	return 1
+}
+
+// reachSitemap reads the sitemaps l lists and reaches its in-scope pages,
+// via a sitemap. It returns the number of fetches started.
+func (c *Crawler) reachSitemap(ctx, drain context.Context, l sitemapList) int {
+	started := 0
+	for _, u := range l.sitemaps {
+		started += c.readSitemap(ctx, drain, u)
+	}
+	for _, u := range l.pages {
+		u = c.opts.Canonicalizer.URL(u)
+		var get getFunc
+		if c.opts.InScope(u) {
+			get = c.fetcher.Fetch
+		}
+		started += c.reach(ctx, drain, u, 0, true, get)
+	}
+	return started
+}
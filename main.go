@@ -1,93 +1,498 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 
+	"github.com/geotho/aragog/canonicalizer"
+	"github.com/geotho/aragog/crawler"
 	"github.com/geotho/aragog/parse"
+	"github.com/geotho/aragog/report"
 	"github.com/geotho/aragog/resource"
+	"github.com/geotho/aragog/scope"
 	"github.com/geotho/aragog/sitemap"
 )
 
 var (
-	Parses         = make(chan resource.Resource, 1000)
-	MaxCrawlers    = flag.Int("crawlers", 20, "Maximum number of crawlers to use.")
-	ActiveCrawlers = make(chan bool, 1000)
-	Crawled        = make(map[url.URL]resource.Resource)
-	Start          = flag.String("url", "", "URL to start crawling from. Usernames etc. will be ignored.")
-	RootURL        url.URL
+	MaxCrawlers   = flag.Int("crawlers", crawler.DefaultMaxCrawlers, "Maximum number of crawlers to use.")
+	SeedsFile     = flag.String("seeds", "", "File of URLs to start crawling from, one per line, as for -url.")
+	MaxDepth      = flag.Int("max-depth", 0, "Maximum click distance from the start URL to crawl. Zero means no limit.")
+	MaxPages      = flag.Int("max-pages", 0, "Maximum number of URLs to fetch from each site. Zero means no limit.")
+	MaxBytes      = flag.Int64("max-bytes", 0, "Stop fetching from a site once this many body bytes have been downloaded from it. Zero means no limit.")
+	UserAgent     = flag.String("user-agent", crawler.DefaultUserAgent, "User-Agent header to send. Its product token selects the robots.txt rules to obey.")
+	IgnoreRobots  = flag.Bool("ignore-robots", false, "Ignore robots.txt. Only use this on sites you own.")
+	RPS           = flag.Float64("rps", 0, "Maximum requests per second to any one host. Zero means no limit.")
+	MaxPerHost    = flag.Int("max-per-host", 0, "Maximum requests in flight to any one host. Zero means no limit.")
+	MaxRetries    = flag.Int("max-retries", parse.DefaultMaxRetries, "Maximum retries of a request that failed or got a 429 or 5xx response. Zero or negative disables retries.")
+	MaxRetryTime  = flag.Duration("max-retry-time", parse.DefaultMaxRetryTime, "Maximum total time to spend retrying one request.")
+	Timeout       = flag.Duration("timeout", 0, "Maximum total crawl duration, e.g. 5m. Zero means no limit.")
+	DrainTimeout  = flag.Duration("drain-timeout", crawler.DefaultDrainTimeout, "How long requests in flight at the -timeout or an interrupt may take to finish.")
+	CheckAssets   = flag.Bool("check-assets", false, "Check every asset, not just stylesheets, is reachable.")
+	CheckExternal = flag.Bool("check-external", false, "Check links and assets on other sites are reachable, without crawling them.")
+	BrokenLinks   = flag.Bool("broken-links", false, "Write a broken link report to out/<host>.broken.txt and .json. Implies -check-assets.")
+	FailOnBroken  = flag.Bool("fail-on-broken", false, "Exit with status 1 if any links or assets are broken. Implies -broken-links.")
+	SitemapSeeds  = flag.Bool("sitemap-seeds", false, "Also crawl the pages listed in each site's sitemaps, from robots.txt Sitemap: lines and /sitemap.xml.")
+	CompareWith   = flag.String("compare-sitemap", "", "URL or file of a sitemap.xml to compare the crawl with. Writes the pages it lists that nothing links to, and the linked pages it is missing, to out/orphans.txt and .json.")
+	Out           = flag.String("out", "out", "Directory to write sitemaps and reports to.")
+	Canonical     = flag.String("canonicalize", "default", "Comma-separated URL canonicalization rules: lowercase, default-port, empty-path, dot-segments, index-files, add-slash, remove-slash, sort-query, strip-params, default or none.")
+	Stream        = flag.String("stream", "", "File to write each crawled URL to as a line of JSON, as soon as it is crawled.")
+	Cluster       = flag.Bool("graphviz-cluster", false, "Group the graphviz sitemap into nested clusters by directory.")
+	ClusterDepth  = flag.Int("graphviz-cluster-depth", 0, "Deepest directory to give its own graphviz cluster. Zero means no limit.")
+	MaxAssets     = flag.Int("graphviz-max-assets", 0, "Most assets to draw in each graphviz cluster; the rest are collapsed into one node. Zero means no limit.")
+	SVGAssets     = flag.Bool("svg-assets", false, "Draw assets as well as pages in the svg sitemap.")
+	TreeSpanning  = flag.Bool("tree-spanning", false, "Draw the tree sitemap as the tree of links first reaching each page from the start URL, instead of by path.")
+	XMLBaseURL    = flag.String("xml-base-url", "", "URL the sitemap.xml files will be served from. Defaults to the root of the site.")
+	XMLGzip       = flag.Bool("xml-gzip", false, "Gzip the sitemap.xml files.")
+	XMLRules      xmlRules
+	Formats       formats
+	Starts        stringsFlag
+	StripParams   stringsFlag
+	Includes      stringsFlag
+	Excludes      stringsFlag
 )
 
+func init() {
+	flag.Var(&Starts, "url", "URL to start crawling from. Usernames etc. will be ignored. Repeatable; each URL's host is crawled as its own site.")
+	flag.Var(&Formats, "format", "Sitemap format to write: "+strings.Join(sitemap.Formats(), ", ")+". Repeatable. (default graphviz and text)")
+	flag.Var(&Includes, "include", "Only crawl URLs matching a scope rule: host:<glob>, path:<prefix>, regex:<regexp> or scheme:<scheme>. Repeatable; a URL must match one rule of each kind given. (default the hosts of -url)")
+	flag.Var(&Excludes, "exclude", "Do not crawl URLs matching a scope rule, written as for -include. Repeatable.")
+	flag.Var(&StripParams, "strip-param", "Query parameter to remove from URLs, e.g. ref, or ref_* to remove all those it prefixes. Repeatable.")
+	flag.Var(&XMLRules, "xml-rule", "Set the changefreq and priority of sitemap.xml pages by path prefix, e.g. /blog/=daily,0.8. Repeatable; the first match wins.")
+}
+
+// formats is a flag.Value collecting repeated -format flags.
+type formats []string
+
+func (f *formats) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *formats) Set(s string) error {
+	if _, err := sitemap.New(s); err != nil {
+		return err
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+// stringsFlag is a flag.Value collecting repeated string flags.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// xmlRules is a flag.Value collecting repeated -xml-rule flags.
+type xmlRules []sitemap.XMLRule
+
+func (r *xmlRules) String() string {
+	return fmt.Sprint(*r)
+}
+
+func (r *xmlRules) Set(s string) error {
+	rule, err := sitemap.ParseXMLRule(s)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, rule)
+	return nil
+}
+
 func main() {
 	flag.Parse()
-	Root := *Start
-	if Root == "" {
+	starts := Starts
+	if *SeedsFile != "" {
+		seeds, err := readSeeds(*SeedsFile)
+		if err != nil {
+			fmt.Printf("Could not read seeds: %s\n", err.Error())
+			return
+		}
+		starts = append(starts, seeds...)
+	}
+	if len(starts) == 0 {
 		fmt.Println("--url flag not specified: using http://news.ycombinator.com/")
-		Root = "http://news.ycombinator.com/"
+		starts = []string{"http://news.ycombinator.com/"}
 	}
 
-	var err error
-	rootURL, err := url.Parse(Root)
-	RootURL = *rootURL
-	if err != nil || !RootURL.IsAbs() {
-		fmt.Printf("Unable to parse given url %s ", RootURL)
+	canon, err := canonicalizer.Parse(*Canonical)
+	if err != nil {
+		fmt.Println(err.Error())
 		return
 	}
+	canon.StripParams = append(append([]string{}, canon.StripParams...), StripParams...)
 
-	Crawl(RootURL)
-	sm := sitemap.TextSiteMap{}
-	sm.SiteMap(Crawled)
+	var rules []scope.Rule
+	for _, f := range []struct {
+		include bool
+		rules   []string
+	}{{true, Includes}, {false, Excludes}} {
+		for _, s := range f.rules {
+			rule, err := scope.ParseRule(f.include, s)
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			rules = append(rules, rule)
+		}
+	}
+	var seeds []url.URL
+	for _, start := range starts {
+		u, err := url.Parse(start)
+		if err != nil || !u.IsAbs() {
+			fmt.Printf("Unable to parse given url %s\n", start)
+			return
+		}
+		seeds = append(seeds, canon.URL(*u))
+	}
+	sites := newSites(seeds, rules)
 
-	(&sitemap.GraphvizSiteMap{}).SiteMap(Crawled)
+	if *FailOnBroken {
+		*BrokenLinks = true
+	}
+	if *BrokenLinks {
+		*CheckAssets = true
+	}
+
+	opts := crawler.Options{
+		Canonicalizer: canon,
+		MaxCrawlers:   *MaxCrawlers,
+		MaxDepth:      *MaxDepth,
+		MaxPages:      *MaxPages,
+		MaxBytes:      *MaxBytes,
+		DrainTimeout:  *DrainTimeout,
+		UserAgent:     *UserAgent,
+		IgnoreRobots:  *IgnoreRobots,
+		HostRate:      *RPS,
+		MaxPerHost:    *MaxPerHost,
+		MaxRetries:    *MaxRetries,
+		MaxRetryTime:  *MaxRetryTime,
+		CheckAssets:   *CheckAssets,
+		CheckExternal: *CheckExternal,
+		SitemapSeeds:  *SitemapSeeds,
+	}
+	// The sitemap to compare with is read within the same limits as the crawl.
+	opts.Pool = crawler.NewPool(opts)
+	var stream *sitemap.JSONLinesWriter
+	if *Stream != "" {
+		f, err := os.Create(*Stream)
+		if err != nil {
+			fmt.Printf("Could not create stream file: %s\n", err.Error())
+			return
+		}
+		defer f.Close()
+		stream = sitemap.NewJSONLinesWriter(f)
+		opts.OnResource = stream.Write
+	}
+
+	ctx, cancel := crawlContext()
+	defer cancel()
+	err = crawlSites(ctx, sites, opts)
+	crawls := make([]map[url.URL]resource.Resource, len(sites))
+	scopes := make([]*scope.Scope, len(sites))
+	hosts := make([]string, len(sites))
+	for i, s := range sites {
+		crawls[i], scopes[i], hosts[i] = s.crawled, s.scope, s.host
+	}
+	crawled := sitemap.Merge(crawls...)
+	if err != nil {
+		fmt.Printf("Crawl stopped early (%s): writing sitemaps of %d resources\n", err.Error(), len(crawled))
+	}
+	if stream != nil && stream.Err() != nil {
+		fmt.Printf("Could not write to stream file: %s\n", stream.Err().Error())
+	}
+
+	if err := os.MkdirAll(*Out, 0777); err != nil {
+		fmt.Printf("Could not create output directory: %s\n", err.Error())
+		return
+	}
+	if len(Formats) == 0 {
+		Formats = formats{"text", "graphviz"}
+	}
+
+	exclusions := scope.CombinedExclusions(scopes...)
+	if err := writeExclusions(filepath.Join(*Out, "scope.txt"), exclusions); err != nil {
+		fmt.Printf("Could not write scope report: %s\n", err.Error())
+	}
+	for _, e := range exclusions {
+		if e.URLs > 0 {
+			fmt.Printf("Excluded %d URLs by %s\n", e.URLs, e.Rule)
+		}
+	}
+
+	if len(sites) > 1 {
+		writeSiteMaps(*Out, "combined", crawled)
+		if err := (&sitemap.CrossSiteMap{Hosts: hosts}).SiteMap(*Out, crawled); err != nil {
+			fmt.Printf("Could not write cross-site graph: %s\n", err.Error())
+		}
+	}
+
+	for _, s := range sites {
+		writeSiteMaps(*Out, s.host, s.crawled)
+		if *BrokenLinks {
+			b := report.BrokenLinks(s.crawled)
+			if err := writeBrokenLinks(filepath.Join(*Out, s.host+".broken"), b); err != nil {
+				fmt.Printf("Could not write broken link report: %s\n", err.Error())
+			}
+			fmt.Printf("Found %d broken links on %s\n", len(b), s.host)
+		}
+	}
+	// Links shared by several sites are counted once.
+	broken := 0
+	if *BrokenLinks {
+		broken = len(report.BrokenLinks(crawled))
+	}
+	if *CompareWith != "" {
+		listed, err := sitemapURLs(ctx, *CompareWith, crawler.New(opts), canon)
+		if err != nil {
+			fmt.Printf("Could not read sitemap to compare with: %s\n", err.Error())
+		} else {
+			c := report.CompareSitemap(crawled, listed)
+			if err := writeSitemapComparison(filepath.Join(*Out, "orphans"), c); err != nil {
+				fmt.Printf("Could not write sitemap comparison: %s\n", err.Error())
+			}
+			fmt.Printf("Found %d orphans and %d pages missing from %s\n", len(c.Orphans), len(c.Unlisted), *CompareWith)
+		}
+	}
+
+	if *FailOnBroken && broken > 0 {
+		cancel()
+		os.Exit(1)
+	}
 	fmt.Println("DONE")
 }
 
-// Crawl ranges over the Parses channel and spawns goroutines to parse
-// previously-unseen URLs. It halts once no new URLs are discovered.
-func Crawl(start url.URL) {
-	for i := 0; i < *MaxCrawlers; i++ {
-		ActiveCrawlers <- true
-	}
-	<-ActiveCrawlers
-	parse.Fetch(start, Parses, ActiveCrawlers)
-	for r := range Parses {
-		r := r
-		fmt.Printf("Crawled %s\n", r.URL.String())
-
-		Crawled[r.URL] = r
-		for l := range r.Links {
-			l := l
-			if shouldCrawl(l) {
-				<-ActiveCrawlers
-				Crawled[l] = resource.Resource{}
-				go parse.Fetch(l, Parses, ActiveCrawlers)
-			}
+// writeSiteMaps writes a sitemap of crawled to dir in each format, with
+// its files named after name.
+func writeSiteMaps(dir, name string, crawled map[url.URL]resource.Resource) {
+	for _, format := range Formats {
+		m := siteMapper(format)
+		var err error
+		if named, ok := m.(sitemap.NamedSiteMapper); ok {
+			err = named.SiteMapNamed(dir, name, crawled)
+		} else {
+			err = m.SiteMap(dir, crawled)
+		}
+		if err != nil {
+			fmt.Printf("Could not write %s sitemap: %s\n", format, err.Error())
 		}
+	}
+}
 
-		for a := range r.Assets {
-			a := a
-			if shouldCrawl(a) && isCSS(a) {
-				<-ActiveCrawlers
-				Crawled[a] = resource.Resource{}
-				go parse.Fetch(a, Parses, ActiveCrawlers)
-			}
+// A site is crawled from the seeds on one host, in a scope of its own.
+type site struct {
+	host    string
+	seeds   []url.URL
+	scope   *scope.Scope
+	crawled map[url.URL]resource.Resource
+}
+
+// newSites groups seeds into a site for each host, in the order of their
+// first seeds. Each site's scope applies rules to a crawl from its seeds.
+func newSites(seeds []url.URL, rules []scope.Rule) []*site {
+	var sites []*site
+	byHost := make(map[string]*site)
+	for _, seed := range seeds {
+		s, ok := byHost[seed.Host]
+		if !ok {
+			s = &site{host: seed.Host}
+			byHost[seed.Host] = s
+			sites = append(sites, s)
 		}
+		s.seeds = append(s.seeds, seed)
+	}
+	for _, s := range sites {
+		s.scope = scope.New(s.seeds, rules...)
+	}
+	return sites
+}
 
-		if len(ActiveCrawlers) == *MaxCrawlers {
-			return
+// crawlSites crawls every site at once, each with a Crawler configured by
+// opts, sharing opts.Pool or else a new crawler.Pool, and records its
+// crawl. It returns the error of any crawl that stopped early.
+func crawlSites(ctx context.Context, sites []*site, opts crawler.Options) error {
+	if opts.Pool == nil {
+		opts.Pool = crawler.NewPool(opts)
+	}
+	errs := make([]error, len(sites))
+	var wg sync.WaitGroup
+	for i, s := range sites {
+		o := opts
+		o.Seeds, o.InScope, o.Excluded = s.seeds, s.scope.InScope, s.scope.Excluded
+		c := crawler.New(o)
+		wg.Add(1)
+		go func(i int, s *site) {
+			defer wg.Done()
+			s.crawled, errs[i] = c.Run(ctx)
+		}(i, s)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// siteMapper returns the SiteMapper for the named format, configured by the flags.
+func siteMapper(name string) sitemap.SiteMapper {
+	m, _ := sitemap.New(name)
+	switch m := m.(type) {
+	case *sitemap.GraphvizSiteMap:
+		m.Cluster, m.ClusterDepth, m.MaxAssets = *Cluster, *ClusterDepth, *MaxAssets
+	case *sitemap.SVGSiteMap:
+		m.Assets = *SVGAssets
+	case *sitemap.TreeSiteMap:
+		m.SpanningTree = *TreeSpanning
+	case *sitemap.XMLSiteMap:
+		m.BaseURL, m.Rules, m.Gzip = *XMLBaseURL, XMLRules, *XMLGzip
+	}
+	return m
+}
+
+// readSeeds reads the URLs in the file at path, one per line. Blank lines
+// and lines starting with # are ignored.
+func readSeeds(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			seeds = append(seeds, line)
 		}
 	}
+	return seeds, scanner.Err()
 }
 
-func isCSS(url url.URL) bool {
-	return strings.HasSuffix(url.Path, ".css")
+// writeExclusions writes the scope report to path.
+func writeExclusions(path string, exclusions []scope.Exclusion) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := scope.WriteExclusionsText(f, exclusions); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sitemapURLs returns the pages listed in the sitemap at s, a URL or a
+// local file, in canonical form. Sitemap indexes are followed, and sitemaps
+// are fetched by c, within the crawl's limits and robots.txt.
+func sitemapURLs(ctx context.Context, s string, c *crawler.Crawler, canon *canonicalizer.Canonicalizer) ([]url.URL, error) {
+	var pages []url.URL
+	if u, err := url.Parse(s); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		if pages, err = c.ReadSitemaps(ctx, []url.URL{*u}); err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := os.Open(s)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		listed, sitemaps, err := parse.ParseSitemap(f)
+		if err != nil {
+			return nil, err
+		}
+		read, err := c.ReadSitemaps(ctx, sitemaps)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(listed, read...)
+	}
+	for i, p := range pages {
+		pages[i] = canon.URL(p)
+	}
+	return pages, nil
 }
 
-func shouldCrawl(url url.URL) bool {
-	url.Fragment = ""
-	_, alreadyCrawled := Crawled[url]
-	sameHost := RootURL.Host == url.Host
-	return !alreadyCrawled && sameHost
+// writeSitemapComparison writes the text and JSON sitemap comparison reports to path.txt and path.json.
+func writeSitemapComparison(path string, c report.SitemapComparison) error {
+	writers := map[string]func(io.Writer, report.SitemapComparison) error{
+		".txt":  report.WriteSitemapComparisonText,
+		".json": report.WriteSitemapComparisonJSON,
+	}
+	for ext, write := range writers {
+		f, err := os.Create(path + ext)
+		if err != nil {
+			return err
+		}
+		if err := write(f, c); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBrokenLinks writes the text and JSON broken link reports to path.txt and path.json.
+func writeBrokenLinks(path string, broken []report.BrokenLink) error {
+	writers := map[string]func(io.Writer, []report.BrokenLink) error{
+		".txt":  report.WriteBrokenLinksText,
+		".json": report.WriteBrokenLinksJSON,
+	}
+	for ext, write := range writers {
+		f, err := os.Create(path + ext)
+		if err != nil {
+			return err
+		}
+		if err := write(f, broken); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// crawlContext returns a context that is cancelled after -timeout, or on
+// the first SIGINT or SIGTERM. A second signal kills the process as usual.
+func crawlContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.Background(), context.CancelFunc(nil)
+	if *Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			fmt.Printf("Received %s: stopping crawl. Send again to quit immediately.\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
 }
@@ -1,33 +1,114 @@
 package main
+
 import (
-	"testing"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
-	"github.com/geotho/aragog/resource"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geotho/aragog/crawler"
+	"github.com/geotho/aragog/report"
+	"github.com/geotho/aragog/scope"
+	"github.com/geotho/aragog/sitemap"
+	"github.com/stretchr/testify/assert"
 )
 
-func TestShouldCrawl(t *testing.T) {
-	initial := parseURL("http://google.com/cat.php")
-	Crawled[initial] = resource.Resource{}
-	RootURL = parseURL("http://google.com")
-
-	testCases := map[string]bool{
-		"http://google.com/cat.php": false,
-		"http://amazon.com/cat.php": false,
-		"http://google.com": true,
-		"http://google.com/": true,
-		"http://google.com/cat.php?args": true,
-		"http://google.com/cat.php#fragment": false,
-		"https://google.com/cat.php": true,
-		"https://google.com/cat.php#fragment": true,
+func TestReadSeeds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seeds.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# microsites\nhttp://a.com/\n\n  http://b.com/docs/  \r\n#http://c.com/\n"), 0666))
+
+	seeds, err := readSeeds(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://a.com/", "http://b.com/docs/"}, seeds)
+
+	_, err = readSeeds(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestNewSites(t *testing.T) {
+	sites := newSites([]url.URL{parseURL("http://a.com/"), parseURL("http://b.com/"), parseURL("http://a.com/blog/")}, nil)
+	if !assert.Len(t, sites, 2) {
+		return
 	}
+	assert.Equal(t, "a.com", sites[0].host)
+	assert.Equal(t, []url.URL{parseURL("http://a.com/"), parseURL("http://a.com/blog/")}, sites[0].seeds)
+	assert.Equal(t, "b.com", sites[1].host)
 
-	for k, v := range testCases {
-		if actual := shouldCrawl(parseURL(k)); actual != v {
-			t.Errorf("%s: Expected %v, got %v",k, v, actual)
-		}
+	// Each seed's host is in the scope of its own site only.
+	assert.True(t, sites[0].scope.InScope(parseURL("http://a.com/about")))
+	assert.False(t, sites[0].scope.InScope(parseURL("http://b.com/about")))
+	assert.True(t, sites[1].scope.InScope(parseURL("http://b.com/about")))
+	assert.False(t, sites[1].scope.InScope(parseURL("http://a.com/about")))
+
+	// Include rules replace the seeds' hosts, so pages on other hosts are in scope.
+	sites = newSites([]url.URL{parseURL("http://a.x/"), parseURL("http://b.x/")}, []scope.Rule{mustParseRule(true, "host:*.x")})
+	for _, s := range sites {
+		assert.True(t, s.scope.InScope(parseURL("http://c.x/")), s.host)
 	}
+}
 
+func TestCrawlSites(t *testing.T) {
+	var b *httptest.Server
+	a := httptest.NewServer(testSite(func() map[string]string {
+		return map[string]string{
+			"/":      `<a href="/about">about</a><a href="` + b.URL + `/">b</a><a href="` + b.URL + `/missing">missing</a>`,
+			"/about": `<a href="/">home</a>`,
+		}
+	}))
+	defer a.Close()
+	b = httptest.NewServer(testSite(func() map[string]string {
+		return map[string]string{
+			"/":        `<a href="/pricing">pricing</a><a href="/missing">missing</a><a href="` + a.URL + `/">a</a>`,
+			"/pricing": ``,
+		}
+	}))
+	defer b.Close()
 
+	sites := newSites([]url.URL{parseURL(a.URL + "/"), parseURL(b.URL + "/")}, nil)
+	err := crawlSites(context.Background(), sites, crawler.Options{MaxCrawlers: 2, CheckExternal: true})
+	assert.NoError(t, err)
+
+	crawledA, crawledB := sites[0].crawled, sites[1].crawled
+	assert.False(t, crawledA[parseURL(a.URL+"/about")].External)
+	assert.True(t, crawledA[parseURL(b.URL+"/")].External, "a checks b's pages without crawling them")
+	assert.NotContains(t, crawledA, parseURL(b.URL+"/pricing"))
+	assert.False(t, crawledB[parseURL(b.URL+"/pricing")].External)
+	assert.True(t, crawledB[parseURL(a.URL+"/")].External)
+
+	crawled := sitemap.Merge(crawledA, crawledB)
+	assert.False(t, crawled[parseURL(a.URL+"/")].External)
+	assert.False(t, crawled[parseURL(b.URL+"/")].External)
+	assert.Contains(t, crawled, parseURL(b.URL+"/pricing"))
+
+	// Each site reports the missing page, but it is one broken link.
+	assert.Len(t, report.BrokenLinks(crawledA), 1)
+	assert.Len(t, report.BrokenLinks(crawledB), 1)
+	assert.Len(t, report.BrokenLinks(crawled), 1)
+}
+
+// testSite serves the pages returned by pages, which is called on each
+// request so pages can link to servers started after it.
+func testSite(pages func() map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages()[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	})
+}
+
+func mustParseRule(include bool, s string) scope.Rule {
+	r, err := scope.ParseRule(include, s)
+	if err != nil {
+		panic(err)
+	}
+	return r
 }
 
 func parseURL(s string) url.URL {
@@ -35,6 +116,5 @@ func parseURL(s string) url.URL {
 	if err != nil {
 		panic(err)
 	}
-
 	return *u
 }
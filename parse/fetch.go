@@ -0,0 +1,426 @@
+package parse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/geotho/aragog/resource"
+)
+
+const (
+	// DefaultMaxRetries is the default of the -max-retries flag.
+	DefaultMaxRetries = 5
+	// DefaultMaxRetryTime is used when Fetcher.MaxRetryTime is zero.
+	DefaultMaxRetryTime = 2 * time.Minute
+	// DefaultMaxRedirects is used when Fetcher.MaxRedirects is zero.
+	DefaultMaxRedirects = 10
+)
+
+var (
+	// ErrRedirectLoop is returned by Follow when a redirect leads back to an earlier URL.
+	ErrRedirectLoop = errors.New("redirect loop")
+	// ErrTooManyRedirects is returned by Follow when a chain exceeds Fetcher.MaxRedirects.
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrRobotsDisallowed may be returned by Fetcher.CheckRedirect to stop at
+	// a hop robots.txt disallows. Fetch then marks the Resource
+	// RobotsDisallowed, rather than recording an error.
+	ErrRobotsDisallowed = errors.New("disallowed by robots.txt")
+)
+
+// DefaultHeaders are the response headers recorded when Fetcher.Headers is nil.
+var DefaultHeaders = []string{
+	"Cache-Control",
+	"Content-Encoding",
+	"Content-Language",
+	"ETag",
+	"Last-Modified",
+	"Location",
+	"Server",
+	"X-Robots-Tag",
+}
+
+// A Fetcher downloads resources and parses them for links and assets.
+// It is safe for concurrent use.
+type Fetcher struct {
+	// Client is used to make requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// UserAgent is sent as the User-Agent header, if set.
+	UserAgent string
+
+	// MaxRetries is the number of times a failed request is retried. If zero
+	// or negative, requests are not retried.
+	MaxRetries int
+	// MaxRetryTime is the total time a request may spend being retried.
+	// If zero, DefaultMaxRetryTime is used.
+	MaxRetryTime time.Duration
+	// MaxRedirects is the longest chain of redirects Follow will follow.
+	// If zero, DefaultMaxRedirects is used.
+	MaxRedirects int
+
+	// Headers lists the response headers recorded on each Resource.
+	// If nil, DefaultHeaders is used.
+	Headers []string
+
+	// OnOverload, if set, is called when a server responds 429 or 503 with the
+	// time until u will be retried, so callers can slow down the whole host.
+	OnOverload func(u url.URL, wait time.Duration)
+	// CheckRedirect, if set, is called before each redirect to u is
+	// followed, with the redirects followed so far, the first of which is
+	// from the URL requested. If it returns an error, u is not requested and
+	// Follow returns the error, wrapped.
+	CheckRedirect func(ctx context.Context, u url.URL, via []resource.Redirect) error
+}
+
+func (f *Fetcher) headers() []string {
+	if f.Headers == nil {
+		return DefaultHeaders
+	}
+	return f.Headers
+}
+
+// client returns a copy of the Fetcher's client that does not follow
+// redirects, so Follow can record each hop.
+func (f *Fetcher) client() *http.Client {
+	c := *http.DefaultClient
+	if f.Client != nil {
+		c = *f.Client
+	}
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &c
+}
+
+func (f *Fetcher) maxRedirects() int {
+	if f.MaxRedirects <= 0 {
+		return DefaultMaxRedirects
+	}
+	return f.MaxRedirects
+}
+
+// Fetch downloads and parses u, signalling done and then sending the
+// resulting Resource on parses. A Resource is always sent, even if u could not
+// be fetched or ctx was cancelled, so callers can count outstanding fetches.
+// Its response metadata and any fetch error are recorded on the Resource.
+// Only HTML and CSS are parsed for links and assets.
+func (f *Fetcher) Fetch(ctx context.Context, u url.URL, parses chan<- resource.Resource, done chan<- bool) {
+	f.fetch(ctx, http.MethodGet, u, parses, done)
+}
+
+// Check is like Fetch, but only requests the headers of u with a HEAD
+// request, so the Resource has no Links or Assets. Servers that do not
+// support HEAD are sent a GET instead, and the body is discarded.
+func (f *Fetcher) Check(ctx context.Context, u url.URL, parses chan<- resource.Resource, done chan<- bool) {
+	f.fetch(ctx, http.MethodHead, u, parses, done)
+}
+
+func (f *Fetcher) fetch(ctx context.Context, method string, u url.URL, parses chan<- resource.Resource, done chan<- bool) {
+	parse := resource.Resource{
+		URL:    u,
+		Links:  make(map[url.URL]bool),
+		Assets: make(map[url.URL]bool),
+	}
+	defer func() { parses <- parse }()
+	// Free the crawler before sending, so a full parses channel cannot starve the caller of crawlers.
+	defer func() { done <- true }()
+
+	start := time.Now()
+	defer func() { parse.Duration = time.Since(start) }()
+	t := &timing{}
+	ctx = httptrace.WithClientTrace(ctx, t.trace())
+
+	// A check's body is never parsed, even if it falls back to a GET.
+	check := method == http.MethodHead
+	resp, final, redirects, err := f.follow(ctx, method, u)
+	if err == nil && check &&
+		(resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		method = http.MethodGet
+		resp, final, redirects, err = f.follow(ctx, method, u)
+	}
+	parse.FinalURL, parse.Redirects = final, redirects
+	if errors.Is(err, ErrRobotsDisallowed) {
+		log.Printf("[Fetch] %s", err.Error())
+		parse.RobotsDisallowed = true
+		return
+	}
+	if err != nil {
+		log.Printf("[Fetch] %s", err.Error())
+		parse.Error = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+	parse.Status = resp.StatusCode
+	parse.Header = selectHeaders(resp.Header, f.headers())
+	parse.ContentType = resp.Header.Get("Content-Type")
+	parse.ContentLength = resp.ContentLength
+	parse.TTFB = t.ttfb()
+	if resp.StatusCode >= http.StatusBadRequest {
+		// Error pages are not part of the site, so their links are not followed.
+		log.Printf("[Fetch] %s: %s\n", u.String(), resp.Status)
+		return
+	}
+
+	body := &countingReader{r: resp.Body}
+	defer func() { parse.Bytes = body.n }()
+	switch {
+	case check:
+		io.Copy(ioutil.Discard, body)
+	case isCSS(final):
+		css, err := ioutil.ReadAll(body)
+		if err != nil {
+			log.Printf("[Fetch] Could not read CSS body of respose to %s: %s\n", u.String(), err.Error())
+			parse.Error = err.Error()
+			return
+		}
+		parse.Assets = ParseCSS(string(css))
+		parse.Elements = make(map[url.URL]string, len(parse.Assets))
+		for a := range parse.Assets {
+			parse.Elements[a] = resource.ElementCSS
+		}
+	case isHTML(parse.ContentType):
+		page, err := ParseHTML(body)
+		if err != nil {
+			log.Printf("[Fetch] Failed to parse HTML: %s\n", err.Error())
+			parse.Error = err.Error()
+		}
+		parse.Links, parse.Assets, parse.Elements = page.Links, page.Assets, page.Elements
+	default:
+		io.Copy(ioutil.Discard, body)
+	}
+
+	(&parse).Normalise()
+}
+
+// isHTML is true if contentType is HTML, or missing so might be.
+func isHTML(contentType string) bool {
+	return contentType == "" || strings.Contains(contentType, "html")
+}
+
+// Follow requests u with Get, following redirects. It returns the final
+// response, the URL it came from, and each redirect followed on the way.
+// Redirect loops, chains longer than MaxRedirects and hops CheckRedirect
+// rejects are errors.
+func (f *Fetcher) Follow(ctx context.Context, u url.URL) (*http.Response, url.URL, []resource.Redirect, error) {
+	return f.follow(ctx, http.MethodGet, u)
+}
+
+func (f *Fetcher) follow(ctx context.Context, method string, u url.URL) (*http.Response, url.URL, []resource.Redirect, error) {
+	var redirects []resource.Redirect
+	seen := map[url.URL]bool{u: true}
+	for {
+		resp, err := f.request(ctx, method, u)
+		if err != nil {
+			return nil, u, redirects, err
+		}
+		location := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || location == "" {
+			return resp, u, redirects, nil
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		redirects = append(redirects, resource.Redirect{URL: u, Status: resp.StatusCode})
+		next, err := u.Parse(location)
+		if err != nil {
+			return nil, u, redirects, fmt.Errorf("invalid redirect from %s to %q: %s", u.String(), location, err.Error())
+		}
+		next.Fragment = ""
+		switch {
+		case seen[*next]:
+			return nil, *next, redirects, ErrRedirectLoop
+		case len(redirects) >= f.maxRedirects():
+			return nil, *next, redirects, ErrTooManyRedirects
+		}
+		if f.CheckRedirect != nil {
+			if err := f.CheckRedirect(ctx, *next, redirects); err != nil {
+				return nil, *next, redirects, fmt.Errorf("redirect from %s to %s: %w", u.String(), next.String(), err)
+			}
+		}
+		seen[*next] = true
+		u = *next
+	}
+}
+
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// Get requests u, without following redirects. Transport errors,
+// 429 Too Many Requests and 5xx responses are retried with exponential
+// backoff, waiting at least as long as any Retry-After header asks, until
+// MaxRetries or MaxRetryTime is reached or ctx is done. Other responses,
+// including 4xx, are returned as they are. If retries run out, the last
+// response or error is returned.
+func (f *Fetcher) Get(ctx context.Context, u url.URL) (*http.Response, error) {
+	return f.request(ctx, http.MethodGet, u)
+}
+
+func (f *Fetcher) request(ctx context.Context, method string, u url.URL) (*http.Response, error) {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = f.maxRetryTime()
+	var retries backoff.BackOff = &backoff.StopBackOff{}
+	if f.MaxRetries > 0 {
+		retries = backoff.WithMaxRetries(b, uint64(f.MaxRetries))
+	}
+	retries = backoff.WithContext(retries, ctx)
+
+	for {
+		resp, err := f.do(ctx, method, u)
+		if err == nil && !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+
+		wait := retries.NextBackOff()
+		if wait == backoff.Stop || ctx.Err() != nil {
+			return resp, err
+		}
+		if err != nil {
+			log.Printf("[Get] %s: %s: retrying in %s\n", u.String(), err.Error(), wait)
+		} else {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok && retryAfter > wait {
+				if b.GetElapsedTime()+retryAfter > b.MaxElapsedTime {
+					// Waiting would exceed MaxRetryTime, so give up now.
+					return resp, nil
+				}
+				wait = retryAfter
+			}
+			log.Printf("[Get] %s: %s: retrying in %s\n", u.String(), resp.Status, wait)
+			if overloaded(resp.StatusCode) && f.OnOverload != nil {
+				f.OnOverload(u, wait)
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// do makes a single request for u.
+func (f *Fetcher) do(ctx context.Context, method string, u url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	return f.client().Do(req)
+}
+
+func (f *Fetcher) maxRetryTime() time.Duration {
+	if f.MaxRetryTime <= 0 {
+		return DefaultMaxRetryTime
+	}
+	return f.MaxRetryTime
+}
+
+// retryable is true for statuses that may succeed if requested again.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// overloaded is true for statuses a server uses to ask clients to slow down.
+func overloaded(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date, into the duration to wait from now.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if t.Before(now) {
+			return 0, true
+		}
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+// selectHeaders returns the named headers present in h.
+func selectHeaders(h http.Header, names []string) http.Header {
+	selected := make(http.Header, len(names))
+	for _, name := range names {
+		if v := h.Values(name); len(v) > 0 {
+			selected[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	return selected
+}
+
+// timing records when requests start and their first response byte arrives.
+// With retries, only the last request counts.
+type timing struct {
+	mu          sync.Mutex
+	start, read time.Time
+}
+
+func (t *timing) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			t.start, t.read = time.Now(), time.Time{}
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.read = time.Now()
+			t.mu.Unlock()
+		},
+	}
+}
+
+// ttfb returns the time to first byte of the last request.
+func (t *timing) ttfb() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.read.IsZero() {
+		return 0
+	}
+	return t.read.Sub(t.start)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,235 @@
+package parse
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyServer responds with statuses in turn, then 200 OK.
+func flakyServer(headers http.Header, statuses ...int) (*httptest.Server, *int32) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		if n <= len(statuses) {
+			for k, v := range headers {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	return ts, &requests
+}
+
+func TestGetRetries(t *testing.T) {
+	testCases := map[string]struct {
+		statuses         []int
+		maxRetries       int
+		expectedStatus   int
+		expectedRequests int32
+	}{
+		"ok":               {nil, DefaultMaxRetries, http.StatusOK, 1},
+		"retries 503":      {[]int{503, 503}, DefaultMaxRetries, http.StatusOK, 3},
+		"retries 429":      {[]int{429}, DefaultMaxRetries, http.StatusOK, 2},
+		"gives up on 404":  {[]int{404}, DefaultMaxRetries, http.StatusNotFound, 1},
+		"gives up on 403":  {[]int{403}, DefaultMaxRetries, http.StatusForbidden, 1},
+		"caps retries":     {[]int{500, 500, 500}, 2, http.StatusInternalServerError, 3},
+		"zero retries":     {[]int{502}, 0, http.StatusBadGateway, 1},
+		"retries disabled": {[]int{502}, -1, http.StatusBadGateway, 1},
+	}
+
+	for name, tc := range testCases {
+		ts, requests := flakyServer(http.Header{"Retry-After": {"0"}}, tc.statuses...)
+		f := &Fetcher{MaxRetries: tc.maxRetries}
+		resp, err := f.Get(context.Background(), parseURL(ts.URL))
+		ts.Close()
+		if assert.NoError(t, err, name) {
+			resp.Body.Close()
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode, name)
+		}
+		assert.Equal(t, tc.expectedRequests, atomic.LoadInt32(requests), name)
+	}
+}
+
+func TestGetHonoursRetryAfter(t *testing.T) {
+	ts, requests := flakyServer(http.Header{"Retry-After": {"1"}}, http.StatusServiceUnavailable)
+	defer ts.Close()
+
+	var overloaded time.Duration
+	f := &Fetcher{MaxRetries: 1, OnOverload: func(u url.URL, wait time.Duration) { overloaded = wait }}
+	start := time.Now()
+	resp, err := f.Get(context.Background(), parseURL(ts.URL))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.True(t, time.Since(start) >= time.Second, "Expected to wait for Retry-After")
+	assert.Equal(t, time.Second, overloaded)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestGetGivesUpIfRetryAfterTooLong(t *testing.T) {
+	ts, requests := flakyServer(http.Header{"Retry-After": {"3600"}}, http.StatusTooManyRequests)
+	defer ts.Close()
+
+	f := &Fetcher{MaxRetries: 1, MaxRetryTime: time.Minute}
+	resp, err := f.Get(context.Background(), parseURL(ts.URL))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		wait time.Duration
+		ok   bool
+	}{
+		"":                              {0, false},
+		"120":                           {2 * time.Minute, true},
+		"-1":                            {0, false},
+		"soon":                          {0, false},
+		"Wed, 21 Oct 2015 07:30:00 GMT": {2 * time.Minute, true},
+		"Wed, 21 Oct 2015 07:00:00 GMT": {0, true},
+	}
+
+	for header, tc := range testCases {
+		wait, ok := parseRetryAfter(header, now)
+		assert.Equal(t, tc.wait, wait, header)
+		assert.Equal(t, tc.ok, ok, header)
+	}
+}
+
+func TestFetchRecordsResponse(t *testing.T) {
+	const page = `<a href="/next">next</a>`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("X-Secret", "not recorded")
+		w.Write([]byte(page))
+	}))
+	defer ts.Close()
+
+	parses := make(chan resource.Resource, 1)
+	done := make(chan bool, 3)
+	f := &Fetcher{MaxRetries: -1}
+
+	f.Fetch(context.Background(), parseURL(ts.URL+"/"), parses, done)
+	r := <-parses
+	assert.Equal(t, http.StatusOK, r.Status)
+	assert.Equal(t, "text/html; charset=utf-8", r.ContentType)
+	assert.Equal(t, int64(len(page)), r.ContentLength)
+	assert.Equal(t, int64(len(page)), r.Bytes)
+	assert.Equal(t, http.Header{"Last-Modified": {"Wed, 21 Oct 2015 07:28:00 GMT"}}, r.Header)
+	assert.True(t, r.TTFB > 0 && r.Duration >= r.TTFB, "TTFB %s, duration %s", r.TTFB, r.Duration)
+	assert.Empty(t, r.Error)
+	assert.True(t, r.Links[parseURL(ts.URL+"/next")])
+
+	f.Fetch(context.Background(), parseURL(ts.URL+"/missing"), parses, done)
+	r = <-parses
+	assert.Equal(t, http.StatusNotFound, r.Status)
+	assert.Empty(t, r.Links)
+
+	ts.Close()
+	f.Fetch(context.Background(), parseURL(ts.URL+"/"), parses, done)
+	r = <-parses
+	assert.Equal(t, 0, r.Status)
+	assert.NotEmpty(t, r.Error)
+}
+
+func TestFollow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			http.Redirect(w, r, "/dir/page#frag", http.StatusFound)
+		case "/dir/page":
+			w.Write([]byte(`<a href="next">next</a>`))
+		case "/loop1":
+			http.Redirect(w, r, "/loop2", http.StatusFound)
+		case "/loop2":
+			http.Redirect(w, r, "/loop1", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	parses := make(chan resource.Resource, 1)
+	done := make(chan bool, 3)
+	f := &Fetcher{MaxRetries: -1}
+
+	f.Fetch(context.Background(), parseURL(ts.URL+"/a"), parses, done)
+	r := <-parses
+	assert.Equal(t, parseURL(ts.URL+"/a"), r.URL)
+	assert.Equal(t, parseURL(ts.URL+"/dir/page"), r.FinalURL)
+	assert.Equal(t, []resource.Redirect{
+		{URL: parseURL(ts.URL + "/a"), Status: http.StatusMovedPermanently},
+		{URL: parseURL(ts.URL + "/b"), Status: http.StatusFound},
+	}, r.Redirects)
+	assert.Equal(t, http.StatusOK, r.Status)
+	assert.Equal(t, map[url.URL]bool{parseURL(ts.URL + "/dir/next"): true}, r.Links, "links resolve against the final URL")
+
+	f.Fetch(context.Background(), parseURL(ts.URL+"/loop1"), parses, done)
+	r = <-parses
+	assert.Equal(t, ErrRedirectLoop.Error(), r.Error)
+	assert.Len(t, r.Redirects, 2)
+
+	f.MaxRedirects = 1
+	_, _, redirects, err := f.Follow(context.Background(), parseURL(ts.URL+"/a"))
+	assert.Equal(t, ErrTooManyRedirects, err)
+	assert.Len(t, redirects, 1)
+}
+
+func TestFollowCheckRedirect(t *testing.T) {
+	var hit int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/private", http.StatusFound)
+		case "/private":
+			atomic.AddInt32(&hit, 1)
+		}
+	}))
+	defer ts.Close()
+
+	var checked []url.URL
+	errPrivate := errors.New("private")
+	f := &Fetcher{MaxRetries: -1, CheckRedirect: func(ctx context.Context, u url.URL, via []resource.Redirect) error {
+		checked = append(checked, u)
+		assert.Equal(t, parseURL(ts.URL+"/a"), via[0].URL)
+		if u.Path == "/private" {
+			return errPrivate
+		}
+		return nil
+	}}
+	_, final, redirects, err := f.Follow(context.Background(), parseURL(ts.URL+"/a"))
+	assert.True(t, errors.Is(err, errPrivate), "got %v", err)
+	assert.Equal(t, parseURL(ts.URL+"/private"), final)
+	assert.Len(t, redirects, 2)
+	assert.Equal(t, []url.URL{parseURL(ts.URL + "/b"), parseURL(ts.URL + "/private")}, checked)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&hit))
+
+	parses := make(chan resource.Resource, 1)
+	f.CheckRedirect = func(context.Context, url.URL, []resource.Redirect) error { return ErrRobotsDisallowed }
+	f.Fetch(context.Background(), parseURL(ts.URL+"/a"), parses, make(chan bool, 1))
+	r := <-parses
+	assert.True(t, r.RobotsDisallowed)
+	assert.Empty(t, r.Error)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&hit))
+}
@@ -3,72 +3,31 @@ package parse
 import (
 	"io"
 	"log"
-	"net/http"
 	"net/url"
 
 	"fmt"
-	"io/ioutil"
 	"strings"
 
-	"github.com/cenkalti/backoff"
 	"github.com/geotho/aragog/resource"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
 
-func Fetch(u url.URL, parses chan<- resource.Resource, done chan<- bool) {
-	defer func() { done <- true }()
-
-	respC := make(chan *http.Response, 1)
-
-	// If MaxCrawlers is too high, some TCP connections die. Retry them if they fail, but not indefinitely.
-	err := backoff.Retry(func() error {
-		resp, err := http.Get(u.String())
-		if err != nil {
-			return err
-		}
-		respC <- resp
-		return nil
-	}, backoff.NewExponentialBackOff())
-	if err != nil {
-		log.Printf("[Fetch] %s", err.Error())
-		return
-	}
-	resp := <-respC
-	defer resp.Body.Close()
-	var parse resource.Resource
-
-	if isCSS(u) {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("[Fetch] Could not read CSS body of respose to %s: %s\n", u, err.Error())
-			return
-		}
-		assets := ParseCSS(string(body))
-		parse = resource.Resource{
-			URL:    u,
-			Links:  make(map[url.URL]bool),
-			Assets: assets,
-		}
-	} else {
-		parse, err = ParseHTML(resp.Body)
-		if err != nil {
-			log.Printf("[Fetch] Failed to parse HTML: %s\n", err.Error())
-		}
-	}
-
-	parse.URL = u
-	(&parse).Normalise()
-	parses <- parse
-}
-
 // ParseHTML takes a body of HTML and returns a Resource containing
-// (possibly relative) URLs to its Links and Assets.
+// (possibly relative) URLs to its Links and Assets, and the Elements
+// referencing each asset.
 // <img>, <link>, <style> and <X style=...> assets are all returned.
 func ParseHTML(body io.Reader) (resource.Resource, error) {
 	r := resource.Resource{
-		Links:  make(map[url.URL]bool),
-		Assets: make(map[url.URL]bool),
+		Links:    make(map[url.URL]bool),
+		Assets:   make(map[url.URL]bool),
+		Elements: make(map[url.URL]string),
+	}
+	addAsset := func(u url.URL, element string) {
+		r.Assets[u] = true
+		if r.Elements[u] == "" {
+			r.Elements[u] = element
+		}
 	}
 
 	z := html.NewTokenizer(body)
@@ -87,13 +46,13 @@ func ParseHTML(body io.Reader) (resource.Resource, error) {
 				if attr, ok := extractAttrToURL(t, atom.Href); ok {
 					// Ignore alternate links
 					if rel := extractAttr(t, atom.Rel); rel == "stylesheet" {
-						r.Assets[*attr] = true
+						addAsset(*attr, resource.ElementLink)
 					}
 				}
 			case atom.Img, atom.Script:
 				// <img> tags load image assets.
 				if attr, ok := extractAttrToURL(t, atom.Src); ok {
-					r.Assets[*attr] = true
+					addAsset(*attr, t.DataAtom.String())
 				}
 			case atom.Style:
 				// CSS between style tags can load more assets.
@@ -102,14 +61,14 @@ func ParseHTML(body io.Reader) (resource.Resource, error) {
 				if tt == html.TextToken {
 					style := string(z.Text())
 					for url := range ParseCSS(style) {
-						r.Assets[url] = true
+						addAsset(url, resource.ElementCSS)
 					}
 				}
 			default:
 				// every element can inline CSS that load more assets e.g. <div style="background: url(...);">.
 				if style := extractAttr(t, atom.Style); style != "" {
 					for url := range ParseCSS(style) {
-						r.Assets[url] = true
+						addAsset(url, resource.ElementCSS)
 					}
 				}
 			}
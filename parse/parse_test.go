@@ -47,8 +47,9 @@ func (s *ParseTestSuite) TestParseHTML() {
 			html: htmlNothing,
 			expectedParse: resource.Resource{
 				// URL: parseURL("http://www.google.com"),
-				Links:  map[url.URL]bool{},
-				Assets: map[url.URL]bool{},
+				Links:    map[url.URL]bool{},
+				Assets:   map[url.URL]bool{},
+				Elements: map[url.URL]string{},
 			},
 		},
 		ParseHTMLTestCase{
@@ -59,7 +60,8 @@ func (s *ParseTestSuite) TestParseHTML() {
 					parseURL("foo.html"):                true,
 					parseURL("www.google.com/bar.html"): true,
 				},
-				Assets: map[url.URL]bool{},
+				Assets:   map[url.URL]bool{},
+				Elements: map[url.URL]string{},
 			},
 		},
 		ParseHTMLTestCase{
@@ -70,6 +72,9 @@ func (s *ParseTestSuite) TestParseHTML() {
 				Assets: map[url.URL]bool{
 					parseURL("style.css"): true,
 				},
+				Elements: map[url.URL]string{
+					parseURL("style.css"): resource.ElementLink,
+				},
 			},
 		},
 		ParseHTMLTestCase{
@@ -80,6 +85,9 @@ func (s *ParseTestSuite) TestParseHTML() {
 				Assets: map[url.URL]bool{
 					parseURL("style.css"): true,
 				},
+				Elements: map[url.URL]string{
+					parseURL("style.css"): resource.ElementLink,
+				},
 			},
 		},
 		ParseHTMLTestCase{
@@ -90,6 +98,9 @@ func (s *ParseTestSuite) TestParseHTML() {
 				Assets: map[url.URL]bool{
 					parseURL("backboneangulargruntgulpnode.js"): true,
 				},
+				Elements: map[url.URL]string{
+					parseURL("backboneangulargruntgulpnode.js"): resource.ElementScript,
+				},
 			},
 		},
 		ParseHTMLTestCase{
@@ -100,6 +111,9 @@ func (s *ParseTestSuite) TestParseHTML() {
 				Assets: map[url.URL]bool{
 					parseURL("meme.jpg"): true,
 				},
+				Elements: map[url.URL]string{
+					parseURL("meme.jpg"): resource.ElementImg,
+				},
 			},
 		},
 		ParseHTMLTestCase{
@@ -110,6 +124,9 @@ func (s *ParseTestSuite) TestParseHTML() {
 				Assets: map[url.URL]bool{
 					parseURL("cat.gif"): true,
 				},
+				Elements: map[url.URL]string{
+					parseURL("cat.gif"): resource.ElementImg,
+				},
 			},
 		},
 		ParseHTMLTestCase{
@@ -126,6 +143,12 @@ func (s *ParseTestSuite) TestParseHTML() {
 					parseURL("meme.jpg"):                        true,
 					parseURL("cat.gif"):                         true,
 				},
+				Elements: map[url.URL]string{
+					parseURL("style.css"):                       resource.ElementLink,
+					parseURL("backboneangulargruntgulpnode.js"): resource.ElementScript,
+					parseURL("meme.jpg"):                        resource.ElementImg,
+					parseURL("cat.gif"):                         resource.ElementImg,
+				},
 			},
 		},
 		ParseHTMLTestCase{
@@ -136,14 +159,18 @@ func (s *ParseTestSuite) TestParseHTML() {
 				Assets: map[url.URL]bool{
 					parseURL("style.css"): true,
 				},
+				Elements: map[url.URL]string{
+					parseURL("style.css"): resource.ElementCSS,
+				},
 			},
 		},
 		ParseHTMLTestCase{
 			html: htmlWithNothingStyle,
 			expectedParse: resource.Resource{
 				// URL: parseURL("http://www.google.com"),
-				Links:  map[url.URL]bool{},
-				Assets: map[url.URL]bool{},
+				Links:    map[url.URL]bool{},
+				Assets:   map[url.URL]bool{},
+				Elements: map[url.URL]string{},
 			},
 		},
 		ParseHTMLTestCase{
@@ -154,6 +181,9 @@ func (s *ParseTestSuite) TestParseHTML() {
 				Assets: map[url.URL]bool{
 					parseURL("style.css"): true,
 				},
+				Elements: map[url.URL]string{
+					parseURL("style.css"): resource.ElementCSS,
+				},
 			},
 		},
 		ParseHTMLTestCase{
@@ -164,6 +194,9 @@ func (s *ParseTestSuite) TestParseHTML() {
 				Assets: map[url.URL]bool{
 					parseURL("cats.bmp"): true,
 				},
+				Elements: map[url.URL]string{
+					parseURL("cats.bmp"): resource.ElementCSS,
+				},
 			},
 		},
 	}
@@ -0,0 +1,80 @@
+package parse
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// MaxSitemapBytes is the most bytes of a sitemap, once decompressed, that
+	// ParseSitemap reads: the sitemaps.org limit.
+	MaxSitemapBytes = 50 << 20
+	// MaxSitemaps is the most sitemaps, including indexes, a crawl reads.
+	MaxSitemaps = 1000
+)
+
+// sitemapXML matches both a <urlset> and a <sitemapindex>.
+type sitemapXML struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// ParseSitemap reads a sitemaps.org sitemap, gzipped or not, and returns
+// the URLs of the pages it lists. If it is a sitemap index, it returns the
+// URLs of the sitemaps it lists instead. Invalid and relative URLs are
+// ignored.
+func ParseSitemap(body io.Reader) (pages, sitemaps []url.URL, err error) {
+	b := bufio.NewReader(body)
+	var r io.Reader = b
+	if magic, _ := b.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var s sitemapXML
+	if err := xml.NewDecoder(io.LimitReader(r, MaxSitemapBytes)).Decode(&s); err != nil {
+		return nil, nil, err
+	}
+	return locURLs(s.URLs), locURLs(s.Sitemaps), nil
+}
+
+func locURLs(locs []sitemapLoc) []url.URL {
+	var urls []url.URL
+	for _, l := range locs {
+		u, err := url.Parse(strings.TrimSpace(l.Loc))
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			continue
+		}
+		urls = append(urls, *u)
+	}
+	return urls
+}
+
+// FetchSitemap fetches and parses the sitemap or sitemap index at u, as
+// for ParseSitemap.
+func (f *Fetcher) FetchSitemap(ctx context.Context, u url.URL) (pages, sitemaps []url.URL, err error) {
+	resp, _, _, err := f.Follow(ctx, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, errors.New(resp.Status)
+	}
+	return ParseSitemap(resp.Body)
+}
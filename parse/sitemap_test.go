@@ -0,0 +1,55 @@
+package parse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const urlsetXML = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://google.com/</loc><lastmod>2020-01-01</lastmod></url>
+  <url><loc>
+    http://google.com/orphan
+  </loc></url>
+  <url><loc>/relative</loc></url>
+</urlset>`
+
+const sitemapIndexXML = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>http://google.com/sitemap-1.xml.gz</loc></sitemap>
+</sitemapindex>`
+
+func TestParseSitemap(t *testing.T) {
+	pages, sitemaps, err := ParseSitemap(strings.NewReader(urlsetXML))
+	assert.NoError(t, err)
+	assert.Equal(t, []url.URL{parseURL("http://google.com/"), parseURL("http://google.com/orphan")}, pages)
+	assert.Empty(t, sitemaps)
+}
+
+func TestParseSitemapIndex(t *testing.T) {
+	pages, sitemaps, err := ParseSitemap(strings.NewReader(sitemapIndexXML))
+	assert.NoError(t, err)
+	assert.Empty(t, pages)
+	assert.Equal(t, []url.URL{parseURL("http://google.com/sitemap-1.xml.gz")}, sitemaps)
+}
+
+func TestParseSitemapGzipped(t *testing.T) {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	gz.Write([]byte(urlsetXML))
+	gz.Close()
+
+	pages, _, err := ParseSitemap(&b)
+	assert.NoError(t, err)
+	assert.Len(t, pages, 2)
+}
+
+func TestParseSitemapInvalid(t *testing.T) {
+	_, _, err := ParseSitemap(strings.NewReader("User-agent: *"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+// Package report analyses crawls for problems worth fixing.
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// A BrokenLink is a link or asset that could not be fetched, or whose
+// response was a 4xx or 5xx error.
+type BrokenLink struct {
+	URL url.URL
+	// Status is the response status code, or zero if there was no response.
+	Status int
+	// Error describes why URL could not be fetched, if it could not.
+	Error string
+	// Sources are the pages that reference URL, sorted by URL.
+	Sources []Source
+}
+
+// A Source is a page that references a BrokenLink.
+type Source struct {
+	URL url.URL
+	// Element is the kind of element that references the BrokenLink, e.g. resource.ElementImg.
+	Element string
+}
+
+// Problem describes what is wrong with b: its status code or its error.
+func (b BrokenLink) Problem() string {
+	if b.Error != "" {
+		return b.Error
+	}
+	return strconv.Itoa(b.Status)
+}
+
+// IsBroken is true if r could not be fetched, or its response was an error.
+// Resources skipped because of robots.txt, or aborted, are not broken.
+func IsBroken(r resource.Resource) bool {
+	return !r.RobotsDisallowed && !IsAborted(r) && (r.Error != "" || r.Status >= 400)
+}
+
+// IsAborted is true if fetching r was cut short because the crawl stopped,
+// e.g. at its timeout, so whether it is broken is unknown.
+func IsAborted(r resource.Resource) bool {
+	return strings.HasSuffix(r.Error, context.Canceled.Error()) ||
+		strings.HasSuffix(r.Error, context.DeadlineExceeded.Error())
+}
+
+// BrokenLinks finds the broken links and assets in crawled, sorted by URL.
+// Broken seeds are included even though no page references them.
+func BrokenLinks(crawled map[url.URL]resource.Resource) []BrokenLink {
+	broken := make(map[url.URL]*BrokenLink)
+	for u, r := range crawled {
+		if IsBroken(r) {
+			broken[u] = &BrokenLink{URL: u, Status: r.Status, Error: r.Error}
+		}
+	}
+
+	for _, r := range crawled {
+		for _, refs := range []map[url.URL]bool{r.Links, r.Assets} {
+			for u := range refs {
+				if b, ok := broken[u]; ok {
+					b.Sources = append(b.Sources, Source{URL: r.URL, Element: r.Element(u)})
+				}
+			}
+		}
+	}
+
+	links := make([]BrokenLink, 0, len(broken))
+	for u, b := range broken {
+		// Unreferenced resources below the seeds are redirect targets,
+		// reported through the URLs that redirect to them.
+		if len(b.Sources) == 0 && crawled[u].Depth > 0 {
+			continue
+		}
+		sort.Slice(b.Sources, func(i, j int) bool {
+			return b.Sources[i].URL.String() < b.Sources[j].URL.String()
+		})
+		links = append(links, *b)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].URL.String() < links[j].URL.String()
+	})
+	return links
+}
+
+// WriteBrokenLinksText writes a tab-indented report of broken, listing
+// each broken URL and its problem followed by the pages referencing it.
+func WriteBrokenLinksText(w io.Writer, broken []BrokenLink) error {
+	for _, b := range broken {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", b.URL.String(), b.Problem()); err != nil {
+			return err
+		}
+		for _, s := range b.Sources {
+			if _, err := fmt.Fprintf(w, "\t%s\t%s\n", s.Element, s.URL.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type brokenLinkJSON struct {
+	URL     string       `json:"url"`
+	Status  int          `json:"status,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Sources []sourceJSON `json:"sources"`
+}
+
+type sourceJSON struct {
+	URL     string `json:"url"`
+	Element string `json:"element"`
+}
+
+// WriteBrokenLinksJSON writes broken as a JSON array.
+func WriteBrokenLinksJSON(w io.Writer, broken []BrokenLink) error {
+	out := make([]brokenLinkJSON, 0, len(broken))
+	for _, b := range broken {
+		j := brokenLinkJSON{URL: b.URL.String(), Status: b.Status, Error: b.Error, Sources: []sourceJSON{}}
+		for _, s := range b.Sources {
+			j.Sources = append(j.Sources, sourceJSON{URL: s.URL.String(), Element: s.Element})
+		}
+		out = append(out, j)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
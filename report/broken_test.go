@@ -0,0 +1,103 @@
+package report
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCrawl() map[url.URL]resource.Resource {
+	page := resource.Resource{
+		URL:      parseURL("http://google.com/"),
+		Status:   200,
+		Links:    makeURLMap("http://google.com/missing", "http://google.com/ok", "http://google.com/private", "http://google.com/slow"),
+		Assets:   makeURLMap("http://google.com/cat.png", "http://google.com/down.js"),
+		Elements: map[url.URL]string{parseURL("http://google.com/cat.png"): resource.ElementImg, parseURL("http://google.com/down.js"): resource.ElementScript},
+	}
+	other := resource.Resource{
+		URL:    parseURL("http://google.com/ok"),
+		Status: 200,
+		Depth:  1,
+		Assets: makeURLMap("http://google.com/cat.png"),
+		Elements: map[url.URL]string{
+			parseURL("http://google.com/cat.png"): resource.ElementCSS,
+		},
+	}
+
+	return map[url.URL]resource.Resource{
+		page.URL:                              page,
+		other.URL:                             other,
+		parseURL("http://google.com/missing"): {URL: parseURL("http://google.com/missing"), Status: 404, Depth: 1},
+		parseURL("http://google.com/cat.png"): {URL: parseURL("http://google.com/cat.png"), Status: 410, Depth: 1},
+		parseURL("http://google.com/down.js"): {URL: parseURL("http://google.com/down.js"), Error: "connection refused", Depth: 1},
+		parseURL("http://google.com/private"): {URL: parseURL("http://google.com/private"), RobotsDisallowed: true, Depth: 1},
+		parseURL("http://google.com/target"):  {URL: parseURL("http://google.com/target"), Status: 404, Depth: 1},
+		parseURL("http://google.com/slow"):    {URL: parseURL("http://google.com/slow"), Error: `Get "http://google.com/slow": context deadline exceeded`, Depth: 1},
+	}
+}
+
+func TestBrokenLinks(t *testing.T) {
+	expected := []BrokenLink{
+		{
+			URL:    parseURL("http://google.com/cat.png"),
+			Status: 410,
+			Sources: []Source{
+				{URL: parseURL("http://google.com/"), Element: resource.ElementImg},
+				{URL: parseURL("http://google.com/ok"), Element: resource.ElementCSS},
+			},
+		},
+		{
+			URL:     parseURL("http://google.com/down.js"),
+			Error:   "connection refused",
+			Sources: []Source{{URL: parseURL("http://google.com/"), Element: resource.ElementScript}},
+		},
+		{
+			URL:     parseURL("http://google.com/missing"),
+			Status:  404,
+			Sources: []Source{{URL: parseURL("http://google.com/"), Element: resource.ElementA}},
+		},
+	}
+
+	assert.Equal(t, expected, BrokenLinks(testCrawl()))
+}
+
+func TestIsAborted(t *testing.T) {
+	assert.True(t, IsAborted(resource.Resource{Error: "context canceled"}))
+	assert.True(t, IsAborted(resource.Resource{Error: `Get "http://google.com/": context deadline exceeded`}))
+	assert.False(t, IsAborted(resource.Resource{Error: "connection refused"}))
+	assert.False(t, IsAborted(resource.Resource{Status: 404}))
+}
+
+func TestWriteBrokenLinks(t *testing.T) {
+	broken := BrokenLinks(testCrawl())
+
+	text := &bytes.Buffer{}
+	assert.NoError(t, WriteBrokenLinksText(text, broken))
+	assert.Equal(t, "http://google.com/cat.png\t410\n"+
+		"\timg\thttp://google.com/\n"+
+		"\tcss\thttp://google.com/ok\n"+
+		"http://google.com/down.js\tconnection refused\n"+
+		"\tscript\thttp://google.com/\n"+
+		"http://google.com/missing\t404\n"+
+		"\ta\thttp://google.com/\n", text.String())
+
+	j := &bytes.Buffer{}
+	assert.NoError(t, WriteBrokenLinksJSON(j, broken[2:]))
+	assert.JSONEq(t, `[{"url": "http://google.com/missing", "status": 404, "sources": [{"url": "http://google.com/", "element": "a"}]}]`, j.String())
+}
+
+func parseURL(parseMe string) url.URL {
+	u, _ := url.Parse(parseMe)
+	return *u
+}
+
+func makeURLMap(ss ...string) map[url.URL]bool {
+	m := make(map[url.URL]bool, len(ss))
+	for _, s := range ss {
+		m[parseURL(s)] = true
+	}
+	return m
+}
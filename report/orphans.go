@@ -0,0 +1,174 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/geotho/aragog/sitemap"
+)
+
+// A SitemapComparison compares the pages a sitemap lists with the pages a
+// crawl found by following links.
+type SitemapComparison struct {
+	// Orphans are listed in the sitemap but not linked from any page the
+	// crawl reached by links from the seeds, so a page linked only from
+	// other orphans is an orphan too. Seeds are not orphans.
+	Orphans []SitemapPage
+	// Unlisted are pages linked from pages reached by links, that belong in
+	// a sitemap, as for sitemap.Pages, but are missing from it.
+	Unlisted []SitemapPage
+}
+
+// A SitemapPage is a page in a SitemapComparison.
+type SitemapPage struct {
+	URL url.URL
+	// Crawled is false if the crawl did not reach URL, so its Status and
+	// Depth are unknown.
+	Crawled bool
+	// Status is the response status code, or zero if there was no response.
+	Status int
+	// Depth is the click depth of URL from the seeds.
+	Depth int
+	// ViaSitemap is true if the crawl reached URL only via a sitemap, so its
+	// Depth from the seeds is unknown.
+	ViaSitemap bool
+	// Error describes why URL could not be fetched, if it could not.
+	Error string
+}
+
+// Problem describes how p was crawled: its status code, its error, or that
+// it was not crawled.
+func (p SitemapPage) Problem() string {
+	switch {
+	case !p.Crawled:
+		return "not crawled"
+	case p.Error != "":
+		return p.Error
+	case p.Status == 0:
+		return "not fetched"
+	}
+	return strconv.Itoa(p.Status)
+}
+
+// CompareSitemap compares listed, the page URLs of a sitemap, with crawled.
+// Both lists in the result are sorted by URL.
+func CompareSitemap(crawled map[url.URL]resource.Resource, listed []url.URL) SitemapComparison {
+	linked := make(map[url.URL]bool)
+	for u, r := range crawled {
+		// Links from pages reached only via a sitemap cannot be followed
+		// from the seeds.
+		if r.External || r.ViaSitemap {
+			continue
+		}
+		for l := range r.Links {
+			if l != u {
+				linked[l] = true
+			}
+		}
+	}
+
+	c := SitemapComparison{Orphans: []SitemapPage{}, Unlisted: []SitemapPage{}}
+	inSitemap := make(map[url.URL]bool, len(listed))
+	for _, u := range listed {
+		if inSitemap[u] {
+			continue
+		}
+		inSitemap[u] = true
+		if r, ok := crawled[u]; !linked[u] && !(ok && r.Depth == 0 && !r.ViaSitemap) {
+			c.Orphans = append(c.Orphans, newSitemapPage(u, crawled))
+		}
+	}
+	for _, r := range sitemap.Pages(crawled) {
+		if linked[r.URL] && !inSitemap[r.URL] {
+			c.Unlisted = append(c.Unlisted, newSitemapPage(r.URL, crawled))
+		}
+	}
+
+	for _, pages := range [][]SitemapPage{c.Orphans, c.Unlisted} {
+		sort.Slice(pages, func(i, j int) bool {
+			return pages[i].URL.String() < pages[j].URL.String()
+		})
+	}
+	return c
+}
+
+func newSitemapPage(u url.URL, crawled map[url.URL]resource.Resource) SitemapPage {
+	r, ok := crawled[u]
+	p := SitemapPage{URL: u, Crawled: ok, Status: r.Status, Depth: r.Depth, ViaSitemap: r.ViaSitemap, Error: r.Error}
+	if p.ViaSitemap {
+		p.Depth = 0
+	}
+	return p
+}
+
+// WriteSitemapComparisonText writes a tab-indented report of c, listing
+// the orphans and then the unlisted pages, each with its status and depth,
+// or "via sitemap" if its depth is unknown.
+func WriteSitemapComparisonText(w io.Writer, c SitemapComparison) error {
+	sections := []struct {
+		heading string
+		pages   []SitemapPage
+	}{
+		{fmt.Sprintf("%d orphans: in the sitemap, but not linked from any crawled page", len(c.Orphans)), c.Orphans},
+		{fmt.Sprintf("%d unlisted: linked, but not in the sitemap", len(c.Unlisted)), c.Unlisted},
+	}
+	for _, s := range sections {
+		if _, err := fmt.Fprintln(w, s.heading); err != nil {
+			return err
+		}
+		for _, p := range s.pages {
+			line := fmt.Sprintf("\t%s\t%s", p.URL.String(), p.Problem())
+			switch {
+			case p.ViaSitemap:
+				line += "\tvia sitemap"
+			case p.Crawled:
+				line += fmt.Sprintf("\tdepth %d", p.Depth)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type sitemapComparisonJSON struct {
+	Orphans  []sitemapPageJSON `json:"orphans"`
+	Unlisted []sitemapPageJSON `json:"unlisted"`
+}
+
+type sitemapPageJSON struct {
+	URL        string `json:"url"`
+	Crawled    bool   `json:"crawled"`
+	Status     int    `json:"status,omitempty"`
+	Depth      *int   `json:"depth,omitempty"`
+	ViaSitemap bool   `json:"via_sitemap,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WriteSitemapComparisonJSON writes c as a JSON object of orphans and
+// unlisted pages. Pages that were not crawled, or were reached only via a
+// sitemap, have no depth.
+func WriteSitemapComparisonJSON(w io.Writer, c SitemapComparison) error {
+	toJSON := func(pages []SitemapPage) []sitemapPageJSON {
+		out := make([]sitemapPageJSON, 0, len(pages))
+		for _, p := range pages {
+			j := sitemapPageJSON{URL: p.URL.String(), Crawled: p.Crawled, Status: p.Status, ViaSitemap: p.ViaSitemap, Error: p.Error}
+			if p.Crawled && !p.ViaSitemap {
+				depth := p.Depth
+				j.Depth = &depth
+			}
+			out = append(out, j)
+		}
+		return out
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sitemapComparisonJSON{Orphans: toJSON(c.Orphans), Unlisted: toJSON(c.Unlisted)})
+}
@@ -0,0 +1,88 @@
+package report
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func orphanTestCrawl() map[url.URL]resource.Resource {
+	crawled := map[url.URL]resource.Resource{}
+	for _, r := range []resource.Resource{
+		{URL: parseURL("http://google.com/"), Status: 200, ContentType: "text/html", Links: makeURLMap("http://google.com/", "http://google.com/listed", "http://google.com/unlisted", "http://google.com/missing")},
+		{URL: parseURL("http://google.com/listed"), Depth: 1, Status: 200, ContentType: "text/html"},
+		{URL: parseURL("http://google.com/unlisted"), Depth: 1, Status: 200, ContentType: "text/html"},
+		{URL: parseURL("http://google.com/missing"), Depth: 1, Status: 404, ContentType: "text/html"},
+		{URL: parseURL("http://google.com/orphan"), Status: 200, ContentType: "text/html", ViaSitemap: true},
+	} {
+		crawled[r.URL] = r
+	}
+	return crawled
+}
+
+func TestCompareSitemap(t *testing.T) {
+	listed := []url.URL{
+		parseURL("http://google.com/orphan"),
+		parseURL("http://google.com/listed"),
+		parseURL("http://google.com/"),
+		parseURL("http://google.com/gone"),
+		parseURL("http://google.com/listed"),
+	}
+
+	assert.Equal(t, SitemapComparison{
+		Orphans: []SitemapPage{
+			{URL: parseURL("http://google.com/gone")},
+			{URL: parseURL("http://google.com/orphan"), Crawled: true, Status: 200, ViaSitemap: true},
+		},
+		Unlisted: []SitemapPage{
+			{URL: parseURL("http://google.com/unlisted"), Crawled: true, Status: 200, Depth: 1},
+		},
+	}, CompareSitemap(orphanTestCrawl(), listed))
+}
+
+func TestCompareSitemapOrphanOfOrphan(t *testing.T) {
+	crawled := orphanTestCrawl()
+	orphan := crawled[parseURL("http://google.com/orphan")]
+	orphan.Links = makeURLMap("http://google.com/orphan-child", "http://google.com/listed")
+	crawled[orphan.URL] = orphan
+	child := resource.Resource{URL: parseURL("http://google.com/orphan-child"), Depth: 1, Status: 200, ContentType: "text/html", ViaSitemap: true}
+	crawled[child.URL] = child
+
+	c := CompareSitemap(crawled, []url.URL{orphan.URL, child.URL, parseURL("http://google.com/listed")})
+	assert.Equal(t, []SitemapPage{
+		{URL: orphan.URL, Crawled: true, Status: 200, ViaSitemap: true},
+		{URL: child.URL, Crawled: true, Status: 200, ViaSitemap: true},
+	}, c.Orphans)
+	assert.Equal(t, []SitemapPage{
+		{URL: parseURL("http://google.com/unlisted"), Crawled: true, Status: 200, Depth: 1},
+	}, c.Unlisted)
+}
+
+func TestWriteSitemapComparison(t *testing.T) {
+	c := CompareSitemap(orphanTestCrawl(), []url.URL{parseURL("http://google.com/orphan"), parseURL("http://google.com/gone")})
+
+	text := &bytes.Buffer{}
+	assert.NoError(t, WriteSitemapComparisonText(text, c))
+	assert.Equal(t, "2 orphans: in the sitemap, but not linked from any crawled page\n"+
+		"\thttp://google.com/gone\tnot crawled\n"+
+		"\thttp://google.com/orphan\t200\tvia sitemap\n"+
+		"2 unlisted: linked, but not in the sitemap\n"+
+		"\thttp://google.com/listed\t200\tdepth 1\n"+
+		"\thttp://google.com/unlisted\t200\tdepth 1\n", text.String())
+
+	j := &bytes.Buffer{}
+	assert.NoError(t, WriteSitemapComparisonJSON(j, c))
+	assert.JSONEq(t, `{
+		"orphans": [
+			{"url": "http://google.com/gone", "crawled": false},
+			{"url": "http://google.com/orphan", "crawled": true, "status": 200, "via_sitemap": true}
+		],
+		"unlisted": [
+			{"url": "http://google.com/listed", "crawled": true, "status": 200, "depth": 1},
+			{"url": "http://google.com/unlisted", "crawled": true, "status": 200, "depth": 1}
+		]
+	}`, j.String())
+}
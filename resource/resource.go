@@ -1,23 +1,112 @@
 package resource
 
-import "net/url"
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
 
 type Resource struct {
+	// URL is where this Resource was requested from.
 	URL    url.URL
 	Links  map[url.URL]bool
 	Assets map[url.URL]bool
+	// Elements holds the kind of element that referenced each of the Assets,
+	// e.g. ElementImg. Links are always referenced by <a> elements.
+	Elements map[url.URL]string
+	// Depth is the number of links followed from a seed URL to discover this Resource.
+	// For Resources reached via a sitemap, it counts from the sitemap.
+	Depth int
+	// ViaSitemap is true if this Resource was not reached by following links
+	// from the seeds, only from a page listed in a sitemap.
+	ViaSitemap bool
+	// RobotsDisallowed is true if robots.txt forbade fetching this Resource.
+	RobotsDisallowed bool
+	// External is true if this Resource is outside the crawl, so was only
+	// checked and not parsed for Links and Assets.
+	External bool
+
+	// FinalURL is where this Resource was fetched from after following any Redirects.
+	FinalURL url.URL
+	// Redirects lists each redirect followed from URL to FinalURL, in order.
+	Redirects []Redirect
+
+	// Status is the HTTP status code of the response, or zero if there was none.
+	Status int
+	// Header holds selected headers of the response.
+	Header http.Header
+	// ContentType is the Content-Type header of the response.
+	ContentType string
+	// ContentLength is the Content-Length header of the response, or -1 if unknown.
+	ContentLength int64
+	// Bytes is the number of body bytes read when fetching this Resource.
+	Bytes int64
+	// TTFB is the time from starting the request to the first response byte.
+	TTFB time.Duration
+	// Duration is the total time taken to fetch this Resource, including retries.
+	Duration time.Duration
+	// Error describes why this Resource could not be fetched, if it could not.
+	Error string
+}
+
+// The kinds of element that reference Links and Assets.
+const (
+	ElementA      = "a"
+	ElementImg    = "img"
+	ElementLink   = "link"
+	ElementScript = "script"
+	// ElementCSS is a CSS url() or @import, in a stylesheet, <style> or style attribute.
+	ElementCSS = "css"
+)
+
+// A Redirect is one hop of a redirect chain: a request for URL that got a
+// redirect response with Status.
+type Redirect struct {
+	URL    url.URL
+	Status int
+}
+
+// Base returns the URL relative links in this Resource are resolved against:
+// FinalURL if this Resource was redirected, otherwise URL.
+func (r *Resource) Base() url.URL {
+	if len(r.Redirects) > 0 {
+		return r.FinalURL
+	}
+	return r.URL
+}
+
+// Element returns the kind of element through which this Resource
+// references u, or "" if it does not.
+func (r *Resource) Element(u url.URL) string {
+	if r.Links[u] {
+		return ElementA
+	}
+	return r.Elements[u]
+}
+
+// IsExternal is true if u is on a different host to this Resource.
+func (r *Resource) IsExternal(u url.URL) bool {
+	base := r.Base()
+	return u.Host != base.Host
 }
 
 // Normalise returns a new Resource with all the Links and Assets
-// replaced with absolute URLs. Invalid URLs, or those not HTTP and HTTPs, are removed.
+// replaced with absolute URLs, resolved against Base. Invalid URLs, or
+// those not HTTP and HTTPs, are removed. Links and Assets on other hosts
+// are kept; IsExternal tells them apart.
 // It also removes URL fragments (e.g. google.com#stuff).
 func (r *Resource) Normalise() {
+	base := r.Base()
 	newLinks := make(map[url.URL]bool, len(r.Links))
 	newAssets := make(map[url.URL]bool, len(r.Assets))
+	var newElements map[url.URL]string
+	if r.Elements != nil {
+		newElements = make(map[url.URL]string, len(r.Elements))
+	}
 
 	for k := range r.Links {
-		absoluteURL := r.URL.ResolveReference(&k)
-		if absoluteURL.Host != r.URL.Host {
+		absoluteURL := base.ResolveReference(&k)
+		if !isHTTP(*absoluteURL) {
 			continue
 		}
 		absoluteURL.Fragment = ""
@@ -25,15 +114,23 @@ func (r *Resource) Normalise() {
 	}
 
 	for k := range r.Assets {
-		absoluteURL := r.URL.ResolveReference(&k)
-		if absoluteURL.Host != r.URL.Host {
+		absoluteURL := base.ResolveReference(&k)
+		if !isHTTP(*absoluteURL) {
 			continue
 		}
 		absoluteURL.Fragment = ""
 		newAssets[*absoluteURL] = true
+		if e, ok := r.Elements[k]; ok && newElements[*absoluteURL] == "" {
+			newElements[*absoluteURL] = e
+		}
 	}
 
 	r.URL.Fragment = ""
 	r.Links = newLinks
 	r.Assets = newAssets
+	r.Elements = newElements
+}
+
+func isHTTP(u url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
 }
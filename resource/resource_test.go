@@ -30,13 +30,15 @@ func TestNormaliseResource(t *testing.T) {
 	amazon := "http://amazon.com/kindle.jpg"
 	actual := &Resource{
 		URL:    parseURL("http://google.com/testcase/"),
-		Links:  makeURLMap(amazon),
+		Links:  makeURLMap(amazon, "mailto:larry@google.com", "javascript:void(0)"),
 		Assets: makeURLMap(amazon),
 	}
 	actual.Normalise()
-	expected := makeURLMap()
+	expected := makeURLMap(amazon)
 	assert.Equal(t, expected, actual.Links, "Expected %s, got %s", expected, actual.Links)
 	assert.Equal(t, expected, actual.Assets, "Expected %s, got %s", expected, actual.Assets)
+	assert.True(t, actual.IsExternal(parseURL(amazon)))
+	assert.False(t, actual.IsExternal(parseURL("http://google.com/foo.png")))
 }
 
 func parseURL(parseMe string) url.URL {
@@ -0,0 +1,195 @@
+// Package robots parses robots.txt files and answers whether a
+// user-agent may crawl a URL, following RFC 9309.
+package robots
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots holds the rules of a robots.txt file.
+// A nil *Robots allows everything.
+type Robots struct {
+	groups []*group
+	// Sitemaps lists the URLs of any Sitemap: directives.
+	Sitemaps []string
+}
+
+// A group is the set of rules that follows one or more user-agent lines.
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// DisallowAll returns Robots that disallow every URL to every user-agent.
+func DisallowAll() *Robots {
+	return &Robots{groups: []*group{{
+		agents: []string{"*"},
+		rules:  []rule{{allow: false, pattern: "/"}},
+	}}}
+}
+
+// Parse reads a robots.txt file. Unknown and malformed lines are ignored.
+func Parse(r io.Reader) (*Robots, error) {
+	robots := &Robots{}
+	var g *group
+	// inAgents is true while reading consecutive user-agent lines, which share a group.
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon == -1 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		value := strings.TrimSpace(line[colon+1:])
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				g = &group{}
+				robots.groups = append(robots.groups, g)
+			}
+			g.agents = append(g.agents, strings.ToLower(value))
+			inAgents = true
+			continue
+		case "allow", "disallow":
+			// An empty Disallow: allows everything, which is the default anyway.
+			if g != nil && value != "" {
+				g.rules = append(g.rules, rule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); g != nil && err == nil && seconds > 0 {
+				g.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			robots.Sitemaps = append(robots.Sitemaps, value)
+		}
+		inAgents = false
+	}
+
+	return robots, scanner.Err()
+}
+
+// Allowed reports whether agent may crawl u.
+func (r *Robots) Allowed(agent string, u url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed, longest := true, -1
+	for _, rl := range r.rulesFor(agent) {
+		if !match(rl.pattern, path) {
+			continue
+		}
+		// The most specific rule wins. Allow wins ties.
+		if n := len(rl.pattern); n > longest || (n == longest && rl.allow) {
+			allowed, longest = rl.allow, n
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay returns the Crawl-delay requested of agent, or zero if none.
+func (r *Robots) CrawlDelay(agent string) time.Duration {
+	var delay time.Duration
+	for _, g := range r.groupsFor(agent) {
+		if g.crawlDelay > delay {
+			delay = g.crawlDelay
+		}
+	}
+	return delay
+}
+
+func (r *Robots) rulesFor(agent string) []rule {
+	var rules []rule
+	for _, g := range r.groupsFor(agent) {
+		rules = append(rules, g.rules...)
+	}
+	return rules
+}
+
+// groupsFor returns the groups naming agent, or the * groups if none do.
+// Groups naming the same agent are merged, as RFC 9309 requires.
+func (r *Robots) groupsFor(agent string) []*group {
+	if r == nil {
+		return nil
+	}
+	agent = strings.ToLower(Token(agent))
+	var named, wildcard []*group
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				wildcard = append(wildcard, g)
+				break
+			}
+			if a == agent {
+				named = append(named, g)
+				break
+			}
+		}
+	}
+	if len(named) > 0 {
+		return named
+	}
+	return wildcard
+}
+
+// Token returns the product token of a User-Agent string, e.g. "aragog"
+// for "aragog/1.0 (+https://github.com/geotho/aragog)".
+func Token(userAgent string) string {
+	if i := strings.IndexAny(userAgent, "/ "); i != -1 {
+		return userAgent[:i]
+	}
+	return userAgent
+}
+
+// match reports whether path matches a robots.txt pattern, in which
+// * matches any sequence of characters and a trailing $ anchors the end.
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	// The first part must be a prefix.
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			// The last part must match the end of the path.
+			return strings.HasSuffix(path, part)
+		}
+		j := strings.Index(path, part)
+		if j == -1 {
+			return false
+		}
+		path = path[j+len(part):]
+	}
+	return !anchored || path == ""
+}
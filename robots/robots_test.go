@@ -0,0 +1,109 @@
+package robots
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const robotsTxt = `
+# comments are ignored
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+Crawl-delay: 2
+
+User-agent: aragog
+User-agent: otherbot
+Disallow: /no-aragog
+Allow: /no-aragog/except
+Crawl-delay: 0.5
+
+user-agent: ARAGOG
+disallow: /also-no-aragog
+
+Sitemap: http://google.com/sitemap.xml
+`
+
+func TestAllowed(t *testing.T) {
+	r, err := Parse(strings.NewReader(robotsTxt))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		agent, url string
+		allowed    bool
+	}{
+		{"somebot", "http://google.com/", true},
+		{"somebot", "http://google.com", true},
+		{"somebot", "http://google.com/private/", false},
+		{"somebot", "http://google.com/private/secret.html", false},
+		{"somebot", "http://google.com/private/public.html", true},
+		{"somebot", "http://google.com/doc.pdf", false},
+		{"somebot", "http://google.com/doc.pdf?download=1", true},
+		{"somebot", "http://google.com/no-aragog", true},
+		{"somebot", "http://google.com/robots.txt", true},
+		{"aragog/1.0 (+https://github.com/geotho/aragog)", "http://google.com/private/", true},
+		{"aragog", "http://google.com/no-aragog/page", false},
+		{"aragog", "http://google.com/no-aragog/except/page", true},
+		{"Aragog", "http://google.com/also-no-aragog", false},
+		{"otherbot", "http://google.com/no-aragog", false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.allowed, r.Allowed(tc.agent, parseURL(tc.url)), "%s fetching %s", tc.agent, tc.url)
+	}
+}
+
+func TestCrawlDelay(t *testing.T) {
+	r, err := Parse(strings.NewReader(robotsTxt))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2*time.Second, r.CrawlDelay("somebot"))
+	assert.Equal(t, 500*time.Millisecond, r.CrawlDelay("aragog"))
+}
+
+func TestSitemaps(t *testing.T) {
+	r, err := Parse(strings.NewReader(robotsTxt))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"http://google.com/sitemap.xml"}, r.Sitemaps)
+}
+
+func TestNilAndDisallowAll(t *testing.T) {
+	var r *Robots
+	assert.True(t, r.Allowed("aragog", parseURL("http://google.com/private/")))
+	assert.Equal(t, time.Duration(0), r.CrawlDelay("aragog"))
+
+	assert.False(t, DisallowAll().Allowed("aragog", parseURL("http://google.com/")))
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern, path string
+		matches       bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish$", "/fish", true},
+		{"/fish$", "/fish/", false},
+		{"/*.php", "/folder/index.php?q=1", true},
+		{"/*.php$", "/folder/index.php?q=1", false},
+		{"/*.php$", "/folder/index.php", true},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.matches, match(tc.pattern, tc.path), "%s against %s", tc.pattern, tc.path)
+	}
+}
+
+func parseURL(parseMe string) url.URL {
+	u, _ := url.Parse(parseMe)
+	return *u
+}
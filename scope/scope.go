@@ -0,0 +1,263 @@
+// Package scope decides which URLs a crawl may visit, by include and
+// exclude rules on their host, path, scheme or the whole URL, and counts the
+// URLs each rule keeps out of the crawl.
+package scope
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The kinds of Rule.
+const (
+	// KindHost matches the host against a glob, e.g. *.example.com. The
+	// port is ignored unless the glob has one.
+	KindHost = "host"
+	// KindPath matches URLs whose path starts with a prefix, e.g. /docs/.
+	KindPath = "path"
+	// KindRegex matches the whole URL against a regular expression.
+	KindRegex = "regex"
+	// KindScheme matches the scheme, e.g. https.
+	KindScheme = "scheme"
+)
+
+// A Rule includes or excludes the URLs matching its Pattern.
+type Rule struct {
+	Include bool
+	Kind    string
+	Pattern string
+
+	re *regexp.Regexp
+}
+
+// ParseRule parses a rule written as kind:pattern, e.g. host:*.example.com,
+// path:/docs/, regex:\?page=\d+$ or scheme:https.
+func ParseRule(include bool, s string) (Rule, error) {
+	colon := strings.IndexByte(s, ':')
+	if colon == -1 {
+		return Rule{}, fmt.Errorf("scope rule %q is not kind:pattern", s)
+	}
+	r := Rule{Include: include, Kind: s[:colon], Pattern: s[colon+1:]}
+	switch r.Kind {
+	case KindHost:
+		r.Pattern = strings.ToLower(r.Pattern)
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return Rule{}, fmt.Errorf("scope rule %q: %s", s, err.Error())
+		}
+	case KindPath:
+	case KindRegex:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return Rule{}, fmt.Errorf("scope rule %q: %s", s, err.Error())
+		}
+		r.re = re
+	case KindScheme:
+		r.Pattern = strings.ToLower(r.Pattern)
+	default:
+		return Rule{}, fmt.Errorf("scope rule %q has unknown kind %q: choose from host, path, regex or scheme", s, r.Kind)
+	}
+	return r, nil
+}
+
+// String returns the rule as written for ParseRule, prefixed by include or exclude.
+func (r Rule) String() string {
+	if r.Include {
+		return "include " + r.Kind + ":" + r.Pattern
+	}
+	return "exclude " + r.Kind + ":" + r.Pattern
+}
+
+// Matches reports whether u matches the rule, whether it includes or excludes u.
+func (r Rule) Matches(u url.URL) bool {
+	switch r.Kind {
+	case KindHost:
+		host := u.Hostname()
+		if strings.Contains(r.Pattern, ":") {
+			host = u.Host
+		}
+		ok, _ := path.Match(r.Pattern, strings.ToLower(host))
+		return ok
+	case KindPath:
+		p := u.Path
+		if p == "" {
+			p = "/"
+		}
+		return strings.HasPrefix(p, r.Pattern)
+	case KindRegex:
+		if r.re == nil {
+			ok, _ := regexp.MatchString(r.Pattern, u.String())
+			return ok
+		}
+		return r.re.MatchString(u.String())
+	case KindScheme:
+		return strings.EqualFold(u.Scheme, r.Pattern)
+	}
+	return false
+}
+
+// A Scope decides which URLs are in scope. A URL is in scope if it matches
+// no exclude rule and, for each kind of rule with include rules, matches at
+// least one of them. Without include host rules, only the hosts of the seeds
+// are in scope.
+//
+// A Scope may be used from several goroutines at once.
+type Scope struct {
+	rules []Rule
+
+	mu sync.Mutex
+	// excluded records, for each URL out of scope, the rule excluding it.
+	excluded map[url.URL]string
+}
+
+// New returns a Scope applying rules to a crawl from seeds.
+func New(seeds []url.URL, rules ...Rule) *Scope {
+	s := &Scope{excluded: make(map[url.URL]string)}
+	hasHost := false
+	for _, r := range rules {
+		hasHost = hasHost || r.Include && r.Kind == KindHost
+	}
+	if !hasHost {
+		for _, seed := range seeds {
+			s.rules = append(s.rules, Rule{Include: true, Kind: KindHost, Pattern: strings.ToLower(seed.Host)})
+		}
+	}
+	s.rules = append(s.rules, rules...)
+	return s
+}
+
+// InScope reports whether u may be crawled. It can be used as
+// crawler.Options.InScope.
+func (s *Scope) InScope(u url.URL) bool {
+	reason, _ := s.exclusion(u)
+	return reason == ""
+}
+
+// Excluded reports whether u is kept out of the crawl by a rule, rather
+// than being on another site: it matches an exclude rule, or is on an
+// included host but matches none of the include rules of another kind.
+// Excluded URLs are not even checked. It can be used as
+// crawler.Options.Excluded.
+func (s *Scope) Excluded(u url.URL) bool {
+	reason, offSite := s.exclusion(u)
+	return reason != "" && !offSite
+}
+
+// exclusion returns the rules excluding u, or "" if u is in scope, and
+// records them. offSite is true if u is only excluded by the host includes.
+func (s *Scope) exclusion(u url.URL) (reason string, offSite bool) {
+	reason, offSite = s.match(u)
+	if reason != "" {
+		s.mu.Lock()
+		s.excluded[u] = reason
+		s.mu.Unlock()
+	}
+	return reason, offSite
+}
+
+func (s *Scope) match(u url.URL) (reason string, offSite bool) {
+	for _, r := range s.rules {
+		if !r.Include && r.Matches(u) {
+			return r.String(), false
+		}
+	}
+	for _, kind := range kinds {
+		includes := s.includes(kind)
+		matched := len(includes) == 0
+		for _, r := range includes {
+			matched = matched || r.Matches(u)
+		}
+		if !matched {
+			return includesString(kind, includes), kind == KindHost
+		}
+	}
+	return "", false
+}
+
+var kinds = []string{KindHost, KindPath, KindRegex, KindScheme}
+
+// includes returns the include rules of kind.
+func (s *Scope) includes(kind string) []Rule {
+	var includes []Rule
+	for _, r := range s.rules {
+		if r.Include && r.Kind == kind {
+			includes = append(includes, r)
+		}
+	}
+	return includes
+}
+
+// includesString describes the include rules of kind together, as they
+// exclude URLs together.
+func includesString(kind string, includes []Rule) string {
+	patterns := make([]string, len(includes))
+	for i, r := range includes {
+		patterns[i] = r.Pattern
+	}
+	return "include " + kind + ":" + strings.Join(patterns, " or ")
+}
+
+// An Exclusion counts the distinct URLs a rule kept out of scope. For
+// include rules, they are those matching none of the include rules of a kind.
+type Exclusion struct {
+	Rule string
+	URLs int
+}
+
+// Exclusions returns the number of URLs each rule excluded so far, in the
+// order of the rules. Rules excluding nothing are listed with zero.
+func (s *Scope) Exclusions() []Exclusion {
+	return CombinedExclusions(s)
+}
+
+// CombinedExclusions returns the Exclusions of several Scopes, e.g. those
+// of the sites in one crawl, in the order of their rules. A rule in more
+// than one Scope is listed once, counting each URL it excluded once.
+func CombinedExclusions(scopes ...*Scope) []Exclusion {
+	excluded := make(map[string]map[url.URL]bool)
+	var exclusions []Exclusion
+	add := func(rule string) {
+		if _, ok := excluded[rule]; !ok {
+			excluded[rule] = make(map[url.URL]bool)
+			exclusions = append(exclusions, Exclusion{Rule: rule})
+		}
+	}
+	for _, s := range scopes {
+		for _, r := range s.rules {
+			if !r.Include {
+				add(r.String())
+			}
+		}
+		for _, kind := range kinds {
+			if includes := s.includes(kind); len(includes) > 0 {
+				add(includesString(kind, includes))
+			}
+		}
+	}
+
+	for _, s := range scopes {
+		s.mu.Lock()
+		for u, reason := range s.excluded {
+			excluded[reason][u] = true
+		}
+		s.mu.Unlock()
+	}
+	for i, e := range exclusions {
+		exclusions[i].URLs = len(excluded[e.Rule])
+	}
+	return exclusions
+}
+
+// WriteExclusionsText writes a line for each Exclusion to w.
+func WriteExclusionsText(w io.Writer, exclusions []Exclusion) error {
+	for _, e := range exclusions {
+		if _, err := fmt.Fprintf(w, "%d\t%s\n", e.URLs, e.Rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
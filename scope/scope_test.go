@@ -0,0 +1,146 @@
+package scope
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule(true, "host:*.Example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "include host:*.example.com", r.String())
+
+	r, err = ParseRule(false, `regex:\?page=\d+$`)
+	assert.NoError(t, err)
+	assert.Equal(t, `exclude regex:\?page=\d+$`, r.String())
+
+	_, err = ParseRule(true, "/docs/")
+	assert.EqualError(t, err, `scope rule "/docs/" is not kind:pattern`)
+	_, err = ParseRule(true, "port:80")
+	assert.EqualError(t, err, `scope rule "port:80" has unknown kind "port": choose from host, path, regex or scheme`)
+	_, err = ParseRule(false, "regex:(")
+	assert.Error(t, err)
+}
+
+func TestInScope(t *testing.T) {
+	s := New([]url.URL{parseURL("http://example.com/docs/")},
+		mustParseRule(true, "host:example.com"),
+		mustParseRule(true, "host:*.example.com"),
+		mustParseRule(true, "path:/docs/"),
+		mustParseRule(true, "path:/api/"),
+		mustParseRule(false, "host:private.example.com"),
+		mustParseRule(false, `regex:\?page=\d+$`),
+		mustParseRule(false, "scheme:http"),
+	)
+
+	testCases := map[string]bool{
+		"https://example.com/docs/":             true,
+		"https://www.example.com/api/v1":        true,
+		"https://example.com:8443/docs/":        true,
+		"https://example.com/blog/":             false,
+		"https://example.com":                   false,
+		"https://other.com/docs/":               false,
+		"https://private.example.com/docs/":     false,
+		"https://example.com/docs/list?page=2":  false,
+		"https://example.com/docs/list?page=2x": true,
+		"http://example.com/docs/":              false,
+	}
+	for u, want := range testCases {
+		assert.Equal(t, want, s.InScope(parseURL(u)), u)
+	}
+}
+
+func TestInScopeDefaultsToSeedHosts(t *testing.T) {
+	s := New([]url.URL{parseURL("http://example.com/"), parseURL("http://www.example.com/")}, mustParseRule(true, "path:/docs/"))
+	assert.True(t, s.InScope(parseURL("http://www.example.com/docs/")))
+	assert.False(t, s.InScope(parseURL("http://blog.example.com/docs/")))
+	assert.False(t, s.InScope(parseURL("http://example.com/blog/")))
+}
+
+func TestExcluded(t *testing.T) {
+	s := New([]url.URL{parseURL("http://example.com/")},
+		mustParseRule(true, "path:/docs/"),
+		mustParseRule(false, "regex:/logout$"),
+	)
+
+	testCases := map[string]bool{
+		"http://example.com/docs/":       false,
+		"http://example.com/blog/":       true,
+		"http://example.com/docs/logout": true,
+		"http://other.com/docs/":         false,
+		"http://other.com/blog/":         false,
+		"http://other.com/docs/logout":   true,
+	}
+	for u, want := range testCases {
+		assert.Equal(t, want, s.Excluded(parseURL(u)), u)
+	}
+	assert.Equal(t, []Exclusion{
+		{Rule: "exclude regex:/logout$", URLs: 2},
+		{Rule: "include host:example.com", URLs: 2},
+		{Rule: "include path:/docs/", URLs: 1},
+	}, s.Exclusions())
+}
+
+func TestExclusions(t *testing.T) {
+	s := New([]url.URL{parseURL("http://example.com/")},
+		mustParseRule(true, "path:/docs/"),
+		mustParseRule(false, "path:/docs/private/"),
+		mustParseRule(false, "scheme:ftp"),
+	)
+	for _, u := range []string{
+		"http://example.com/docs/",
+		"http://example.com/blog/",
+		"http://example.com/blog/",
+		"http://example.com/about",
+		"http://example.com/docs/private/a",
+		"http://other.com/docs/",
+	} {
+		s.InScope(parseURL(u))
+	}
+
+	exclusions := s.Exclusions()
+	assert.Equal(t, []Exclusion{
+		{Rule: "exclude path:/docs/private/", URLs: 1},
+		{Rule: "exclude scheme:ftp", URLs: 0},
+		{Rule: "include host:example.com", URLs: 1},
+		{Rule: "include path:/docs/", URLs: 2},
+	}, exclusions)
+
+	var b bytes.Buffer
+	assert.NoError(t, WriteExclusionsText(&b, exclusions))
+	assert.Equal(t, "1\texclude path:/docs/private/\n0\texclude scheme:ftp\n1\tinclude host:example.com\n2\tinclude path:/docs/\n", b.String())
+}
+
+func TestCombinedExclusions(t *testing.T) {
+	logout := mustParseRule(false, "path:/logout")
+	a := New([]url.URL{parseURL("http://a.com/")}, logout)
+	b := New([]url.URL{parseURL("http://b.com/")}, logout)
+	for _, u := range []string{"http://a.com/logout", "http://b.com/", "http://c.com/"} {
+		a.InScope(parseURL(u))
+	}
+	for _, u := range []string{"http://a.com/logout", "http://b.com/logout", "http://a.com/"} {
+		b.InScope(parseURL(u))
+	}
+
+	assert.Equal(t, []Exclusion{
+		{Rule: "exclude path:/logout", URLs: 2},
+		{Rule: "include host:a.com", URLs: 2},
+		{Rule: "include host:b.com", URLs: 1},
+	}, CombinedExclusions(a, b))
+}
+
+func mustParseRule(include bool, s string) Rule {
+	r, err := ParseRule(include, s)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func parseURL(s string) url.URL {
+	u, _ := url.Parse(s)
+	return *u
+}
@@ -0,0 +1,66 @@
+package sitemap
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// A CytoscapeSiteMap writes the crawl graph as Cytoscape.js JSON elements,
+// which Cytoscape desktop can also import. Each node and edge's data holds
+// its kind and metadata.
+type CytoscapeSiteMap struct{}
+
+type cytoscapeElements struct {
+	Nodes []cytoscapeElement `json:"nodes"`
+	Edges []cytoscapeElement `json:"edges"`
+}
+
+type cytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// SiteMap writes the crawl graph to dir/siteroot.cyjs.
+func (m *CytoscapeSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return m.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes the crawl graph to dir/name.cyjs.
+func (m *CytoscapeSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, name+".cyjs"), m, crawled)
+}
+
+// Encode writes the crawl graph to w as {"elements": {"nodes": [...], "edges": [...]}}.
+func (m *CytoscapeSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	elements := cytoscapeElements{Nodes: []cytoscapeElement{}, Edges: []cytoscapeElement{}}
+
+	g := newGraph(crawled)
+	for i, n := range g.nodes {
+		data := cytoscapeData(nodeAttributes, n.values())
+		data["id"] = nodeID(i)
+		data["label"] = n.URL.String()
+		elements.Nodes = append(elements.Nodes, cytoscapeElement{data})
+	}
+	for i, e := range g.edges {
+		data := cytoscapeData(edgeAttributes, e.values())
+		data["id"] = edgeID(i)
+		data["source"] = nodeID(e.From)
+		data["target"] = nodeID(e.To)
+		elements.Edges = append(elements.Edges, cytoscapeElement{data})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]cytoscapeElements{"elements": elements})
+}
+
+func cytoscapeData(attrs []attribute, values []interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(attrs)+3)
+	for i, a := range attrs {
+		data[a.Name] = values[i]
+	}
+	return data
+}
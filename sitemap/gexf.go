@@ -0,0 +1,119 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// A GEXFSiteMap writes the crawl graph as GEXF, for Gephi.
+// Nodes and edges carry their kind and metadata as attributes.
+type GEXFSiteMap struct{}
+
+type gexf struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string              `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributeList `xml:"attributes"`
+	Nodes           []gexfNode          `xml:"nodes>node"`
+	Edges           []gexfEdge          `xml:"edges>edge"`
+}
+
+type gexfAttributeList struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// SiteMap writes the crawl graph to dir/siteroot.gexf.
+func (m *GEXFSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return m.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes the crawl graph to dir/name.gexf.
+func (m *GEXFSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, name+".gexf"), m, crawled)
+}
+
+// Encode writes the crawl graph to w as GEXF 1.3.
+func (m *GEXFSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	doc := gexf{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Graph: gexfGraph{
+			DefaultEdgeType: "directed",
+			Attributes: []gexfAttributeList{
+				{Class: "node", Attributes: gexfAttributes(nodeAttributes)},
+				{Class: "edge", Attributes: gexfAttributes(edgeAttributes)},
+			},
+		},
+	}
+
+	g := newGraph(crawled)
+	for i, n := range g.nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{ID: nodeID(i), Label: n.URL.String(), AttValues: gexfValues(n.values())})
+	}
+	for i, e := range g.edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:        edgeID(i),
+			Source:    nodeID(e.From),
+			Target:    nodeID(e.To),
+			AttValues: gexfValues(e.values()),
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+func gexfAttributes(attrs []attribute) []gexfAttribute {
+	out := make([]gexfAttribute, len(attrs))
+	for i, a := range attrs {
+		t := a.Type
+		if t == "int" {
+			t = "integer"
+		}
+		out[i] = gexfAttribute{ID: strconv.Itoa(i), Title: a.Name, Type: t}
+	}
+	return out
+}
+
+func gexfValues(values []interface{}) []gexfAttValue {
+	out := make([]gexfAttValue, len(values))
+	for i, v := range values {
+		out[i] = gexfAttValue{For: strconv.Itoa(i), Value: fmt.Sprint(v)}
+	}
+	return out
+}
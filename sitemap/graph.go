@@ -0,0 +1,172 @@
+package sitemap
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// The kinds of resource a URL is classified as, by its extension.
+const (
+	KindPage       = "page"
+	KindImage      = "image"
+	KindScript     = "script"
+	KindStylesheet = "stylesheet"
+	KindOther      = "other"
+)
+
+// Kind classifies u by the extension of its path as KindPage, KindImage,
+// KindScript, KindStylesheet or KindOther.
+func Kind(u url.URL) string {
+	switch filepath.Ext(u.Path) {
+	case "", ".html", ".htm", ".php":
+		return KindPage
+	case ".gif", ".png", ".jpg", ".jpeg":
+		return KindImage
+	case ".js":
+		return KindScript
+	case ".css":
+		return KindStylesheet
+	default:
+		return KindOther
+	}
+}
+
+// The kinds of edge between URLs.
+const (
+	EdgeLink     = "link"
+	EdgeAsset    = "asset"
+	EdgeRedirect = "redirect"
+)
+
+// A graph is the crawl as nodes and edges, for writing to graph tools.
+// Nodes are sorted by URL and numbered by their index.
+type graph struct {
+	nodes []graphNode
+	edges []graphEdge
+}
+
+// A graphNode is a crawled URL, or one that was referenced but not fetched.
+type graphNode struct {
+	resource.Resource
+	Crawled bool
+}
+
+// A graphEdge is a link, asset or redirect from one node to another.
+type graphEdge struct {
+	From, To int
+	// Kind is EdgeLink, EdgeAsset or EdgeRedirect.
+	Kind    string
+	Element string
+	Status  int
+}
+
+// An attribute is a named, typed value on every node or edge.
+type attribute struct {
+	Name string
+	// Type is "string", "int", "long" or "boolean".
+	Type string
+}
+
+var nodeAttributes = []attribute{
+	{"url", "string"},
+	{"kind", "string"},
+	{"crawled", "boolean"},
+	{"external", "boolean"},
+	{"robots_disallowed", "boolean"},
+	{"depth", "int"},
+	{"status", "int"},
+	{"content_type", "string"},
+	{"bytes", "long"},
+	{"error", "string"},
+	{"via_sitemap", "boolean"},
+}
+
+var edgeAttributes = []attribute{
+	{"kind", "string"},
+	{"element", "string"},
+	{"status", "int"},
+}
+
+// values returns the values of n's nodeAttributes, in order.
+func (n graphNode) values() []interface{} {
+	return []interface{}{n.URL.String(), Kind(n.URL), n.Crawled, n.External, n.RobotsDisallowed, n.Depth, n.Status, n.ContentType, n.Bytes, n.Error, n.ViaSitemap}
+}
+
+// values returns the values of e's edgeAttributes, in order.
+func (e graphEdge) values() []interface{} {
+	return []interface{}{e.Kind, e.Element, e.Status}
+}
+
+// newGraph builds the graph of crawled, with a node for each crawled URL and
+// each URL they reference or redirect to, and an edge for each reference and
+// redirect. Links and assets of a redirected URL are drawn from its FinalURL.
+func newGraph(crawled map[url.URL]resource.Resource) graph {
+	resources := sortedResources(crawled)
+
+	all := make(map[url.URL]graphNode, len(crawled))
+	for _, r := range resources {
+		all[r.URL] = graphNode{Resource: r, Crawled: true}
+	}
+	for _, r := range resources {
+		refs := []url.URL{r.Base()}
+		for _, hop := range r.Redirects {
+			refs = append(refs, hop.URL)
+		}
+		refs = append(refs, sortedURLs(r.Links)...)
+		refs = append(refs, sortedURLs(r.Assets)...)
+		for _, u := range refs {
+			if _, ok := all[u]; !ok {
+				all[u] = graphNode{Resource: resource.Resource{URL: u, External: r.IsExternal(u)}}
+			}
+		}
+	}
+
+	urls := make(map[url.URL]bool, len(all))
+	for u := range all {
+		urls[u] = true
+	}
+	g := graph{}
+	ids := make(map[url.URL]int, len(all))
+	for _, u := range sortedURLs(urls) {
+		ids[u] = len(g.nodes)
+		g.nodes = append(g.nodes, all[u])
+	}
+
+	seen := make(map[graphEdge]bool)
+	add := func(e graphEdge) {
+		if !seen[e] {
+			seen[e] = true
+			g.edges = append(g.edges, e)
+		}
+	}
+	for _, r := range resources {
+		for i, hop := range r.Redirects {
+			to := r.FinalURL
+			if i+1 < len(r.Redirects) {
+				to = r.Redirects[i+1].URL
+			}
+			add(graphEdge{From: ids[hop.URL], To: ids[to], Kind: EdgeRedirect, Status: hop.Status})
+		}
+		from := ids[r.Base()]
+		for _, l := range sortedURLs(r.Links) {
+			add(graphEdge{From: from, To: ids[l], Kind: EdgeLink, Element: resource.ElementA})
+		}
+		for _, a := range sortedURLs(r.Assets) {
+			add(graphEdge{From: from, To: ids[a], Kind: EdgeAsset, Element: r.Element(a)})
+		}
+	}
+	return g
+}
+
+// nodeID returns the ID of the node at index i.
+func nodeID(i int) string {
+	return fmt.Sprintf("n%d", i)
+}
+
+// edgeID returns the ID of the edge at index i.
+func edgeID(i int) string {
+	return fmt.Sprintf("e%d", i)
+}
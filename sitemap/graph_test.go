@@ -0,0 +1,92 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKind(t *testing.T) {
+	for u, kind := range map[string]string{
+		"http://google.com/":           KindPage,
+		"http://google.com/about.html": KindPage,
+		"http://google.com/cat.png":    KindImage,
+		"http://google.com/app.js":     KindScript,
+		"http://google.com/style.css":  KindStylesheet,
+		"http://google.com/paper.pdf":  KindOther,
+	} {
+		assert.Equal(t, kind, Kind(parseURL(u)), u)
+	}
+}
+
+func TestNewGraph(t *testing.T) {
+	g := newGraph(jsonTestCrawl())
+
+	var urls []string
+	for _, n := range g.nodes {
+		urls = append(urls, n.URL.String())
+	}
+	assert.Equal(t, []string{"http://google.com/", "http://google.com/cat.png", "http://google.com/new", "http://google.com/old"}, urls)
+	assert.True(t, g.nodes[0].Crawled)
+	assert.False(t, g.nodes[1].Crawled)
+
+	assert.Equal(t, []graphEdge{
+		{From: 0, To: 3, Kind: EdgeLink, Element: resource.ElementA},
+		{From: 0, To: 1, Kind: EdgeAsset, Element: resource.ElementImg},
+		{From: 3, To: 2, Kind: EdgeRedirect, Status: 301},
+	}, g.edges)
+}
+
+func TestGraphMLSiteMap(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&GraphMLSiteMap{}).Encode(b, jsonTestCrawl()))
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &struct{}{}))
+
+	s := b.String()
+	assert.Contains(t, s, `<key id="n_kind" for="node" attr.name="kind" attr.type="string"></key>`)
+	assert.Contains(t, s, `<graph id="G" edgedefault="directed">`)
+	assert.Contains(t, s, `<node id="n1">
+      <data key="n_url">http://google.com/cat.png</data>
+      <data key="n_kind">image</data>`)
+	assert.Contains(t, s, `<edge id="e1" source="n0" target="n1">
+      <data key="e_kind">asset</data>
+      <data key="e_element">img</data>`)
+}
+
+func TestGEXFSiteMap(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&GEXFSiteMap{}).Encode(b, jsonTestCrawl()))
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &struct{}{}))
+
+	s := b.String()
+	assert.Contains(t, s, `<gexf xmlns="http://gexf.net/1.3" version="1.3">`)
+	assert.Contains(t, s, `<attribute id="5" title="depth" type="integer"></attribute>`)
+	assert.Contains(t, s, `<node id="n0" label="http://google.com/">`)
+	assert.Contains(t, s, `<attvalue for="1" value="page"></attvalue>`)
+	assert.Contains(t, s, `<edge id="e2" source="n3" target="n2">`)
+}
+
+func TestCytoscapeSiteMap(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&CytoscapeSiteMap{}).Encode(b, jsonTestCrawl()))
+
+	var doc struct {
+		Elements struct {
+			Nodes []struct{ Data map[string]interface{} }
+			Edges []struct{ Data map[string]interface{} }
+		}
+	}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &doc))
+	if assert.Len(t, doc.Elements.Nodes, 4) && assert.Len(t, doc.Elements.Edges, 3) {
+		n := doc.Elements.Nodes[0].Data
+		assert.Equal(t, "n0", n["id"])
+		assert.Equal(t, "page", n["kind"])
+		assert.Equal(t, float64(200), n["status"])
+		assert.Equal(t, true, n["crawled"])
+		assert.Equal(t, map[string]interface{}{"id": "e0", "source": "n0", "target": "n3", "kind": "link", "element": "a", "status": float64(0)}, doc.Elements.Edges[0].Data)
+	}
+}
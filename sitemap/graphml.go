@@ -0,0 +1,114 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// A GraphMLSiteMap writes the crawl graph as GraphML, for yEd and other graph tools.
+// Nodes and edges carry their kind and metadata as data.
+type GraphMLSiteMap struct{}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// SiteMap writes the crawl graph to dir/siteroot.graphml.
+func (m *GraphMLSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return m.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes the crawl graph to dir/name.graphml.
+func (m *GraphMLSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, name+".graphml"), m, crawled)
+}
+
+// Encode writes the crawl graph to w as GraphML.
+func (m *GraphMLSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Graph: graphMLGraph{ID: "G", EdgeDefault: "directed"},
+	}
+	for _, a := range nodeAttributes {
+		doc.Keys = append(doc.Keys, graphMLKey{ID: "n_" + a.Name, For: "node", Name: a.Name, Type: a.Type})
+	}
+	for _, a := range edgeAttributes {
+		doc.Keys = append(doc.Keys, graphMLKey{ID: "e_" + a.Name, For: "edge", Name: a.Name, Type: a.Type})
+	}
+
+	g := newGraph(crawled)
+	for i, n := range g.nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: nodeID(i), Data: graphMLValues("n_", nodeAttributes, n.values())})
+	}
+	for i, e := range g.edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     edgeID(i),
+			Source: nodeID(e.From),
+			Target: nodeID(e.To),
+			Data:   graphMLValues("e_", edgeAttributes, e.values()),
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+func graphMLValues(prefix string, attrs []attribute, values []interface{}) []graphMLData {
+	data := make([]graphMLData, len(attrs))
+	for i, a := range attrs {
+		data[i] = graphMLData{Key: prefix + a.Name, Value: fmt.Sprint(values[i])}
+	}
+	return data
+}
+
+// writeXML writes v to w as an indented XML document.
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
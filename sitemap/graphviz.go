@@ -1,12 +1,14 @@
 package sitemap
 
 import (
-	"io/ioutil"
+	"fmt"
+	"io"
 	"log"
 	url "net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/geotho/aragog/resource"
@@ -15,6 +17,17 @@ import (
 
 // A GraphvizSiteMap produces a .dot file and a .pdf of the crawled site.
 type GraphvizSiteMap struct {
+	// Cluster groups nodes into nested clusters by the directories in their
+	// paths, e.g. /wp-content/uploads/2015/10, so the graph follows the
+	// structure of the site. URLs on other hosts are clustered by host.
+	Cluster bool
+	// ClusterDepth is the deepest directory that gets its own cluster.
+	// Deeper URLs join the cluster of their ancestor. Zero means no limit.
+	ClusterDepth int
+	// MaxAssets is the most assets drawn in any one cluster. The rest are
+	// collapsed into a single "N more assets" node. Zero means no limit.
+	MaxAssets int
+
 	edges map[edge]bool
 }
 
@@ -27,7 +40,15 @@ type edge struct {
 	from, to string
 }
 
+// ID returns the Graphviz node ID of g: its whole URL, quoted. Distinct
+// URLs always have distinct IDs.
+func (g GraphvizURL) ID() string {
+	return quoteID(g.URL.String())
+}
+
 // String removes special characters from g.URL.String() which cause graphviz to barf.
+//
+// Deprecated: distinct URLs, e.g. /a-b and /ab, have the same String. Use ID.
 func (g GraphvizURL) String() string {
 	r := strings.NewReplacer("-", "", "/", "", ":", "", ".", "", "?", "", "@", "", "%", "", "=", "", "&", "")
 	s := g.URL.String()
@@ -36,12 +57,7 @@ func (g GraphvizURL) String() string {
 
 // IsPage is true iff URL has no extension, or is .html or .htm or .php.
 func (g GraphvizURL) IsPage() bool {
-	ext := filepath.Ext(g.Path)
-	switch ext {
-	case "", ".html", ".htm", ".php":
-		return true
-	}
-	return false
+	return Kind(g.URL) == KindPage
 }
 
 // NodeAttrs returns an attribute map for this URL.
@@ -49,7 +65,7 @@ func (g GraphvizURL) NodeAttrs() map[string]string {
 	m := make(map[string]string)
 	m["style"] = "filled"
 	m["fillcolor"] = g.Colour()
-	m["label"] = g.BadString()
+	m["label"] = quoteID(g.BadString())
 	if g.IsPage() {
 		m["fontsize"] = "20"
 		m["shape"] = "box"
@@ -64,17 +80,16 @@ func (g GraphvizURL) BadString() string {
 
 // Colour returns a hex colour for the type of resource this URL represents.
 func (g GraphvizURL) Colour() string {
-	ext := filepath.Ext(g.Path)
-	switch ext {
-	case "", ".html", ".htm", ".php":
+	switch Kind(g.URL) {
+	case KindPage:
 		return "#DDDDDD"
-	case ".gif", ".png", ".jpg", ".jpeg":
+	case KindImage:
 		// pink
 		return "#FFC6BC"
-	case ".js":
+	case KindScript:
 		// blue
 		return "#A7D3D2"
-	case ".css":
+	case KindStylesheet:
 		// orange
 		return "#F7A541"
 	default:
@@ -83,6 +98,13 @@ func (g GraphvizURL) Colour() string {
 	}
 }
 
+// externalNodeAttrs returns an attribute map for an external URL that was not checked.
+func externalNodeAttrs(u url.URL) map[string]string {
+	m := GraphvizURL{u}.NodeAttrs()
+	m["style"] = "dotted"
+	return m
+}
+
 // MakeNewEdge creates a new edge between from and to iff it does not already exist.
 func (m *GraphvizSiteMap) MakeNewEdge(g *gv.Graph, from, to string, attrs map[string]string) {
 	if m.edges == nil {
@@ -94,45 +116,173 @@ func (m *GraphvizSiteMap) MakeNewEdge(g *gv.Graph, from, to string, attrs map[st
 	}
 }
 
-// SiteMap writes a .dot and a .pdf (if you have graphviz installed) to out/siteroot.dot
-func (m *GraphvizSiteMap) SiteMap(crawled map[url.URL]resource.Resource) {
+// SiteMap writes a .dot to dir/siteroot.dot, and a .pdf to dir/siteroot.dot.pdf
+// if you have graphviz installed. If not, it draws dir/siteroot.svg with an SVGSiteMap.
+func (m *GraphvizSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return m.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes dir/name.dot and dir/name.dot.pdf, or dir/name.svg.
+func (m *GraphvizSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	path := filepath.Join(dir, name+".dot")
+	if err := writeFile(path, m, crawled); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("dot", "-v", "-Tpdf", path, "-O")
+	cmd.Dir, _ = os.Getwd()
+	_, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("Could not make pdf: %s\n Is dot installed? Drawing an SVG instead.\n", err.Error())
+		return (&SVGSiteMap{}).SiteMapNamed(dir, name, crawled)
+	}
+	return nil
+}
+
+// Encode writes the .dot source of the graph of crawled to w.
+func (m *GraphvizSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	_, err := io.WriteString(w, m.Graph(crawled).String())
+	return err
+}
+
+// Graph returns the graph of crawled: a node for each URL and an edge for each link, asset and redirect.
+func (m *GraphvizSiteMap) Graph(crawled map[url.URL]resource.Resource) *gv.Graph {
 	// TODO: treat .html, .php "", different e.g. bigger
+	m.edges = nil
 	g := gv.NewGraph()
 	g.SetName("G")
 	g.SetDir(true)
 	g.SetStrict(true)
 	g.AddAttr("G", "ranksep", "3")
 	g.AddAttr("G", "ratio", "auto")
-	for k := range crawled {
-		k := GraphvizURL{k}
-		g.AddNode("G", k.String(), k.NodeAttrs())
-	}
-	for k, v := range crawled {
-		k := GraphvizURL{k}
-		for link := range v.Links {
-			link := GraphvizURL{link}
-			m.MakeNewEdge(g, k.String(), link.String(), map[string]string{"style": "bold"})
 
+	d := drawing{nodes: make(map[url.URL]map[string]string)}
+	resources := sortedResources(crawled)
+	for _, v := range resources {
+		d.nodes[v.URL] = resourceNodeAttrs(v)
+	}
+	for _, v := range resources {
+		from := v.URL
+		if len(v.Redirects) > 0 {
+			d.redirectEdges(v)
+			// The redirect target's links are drawn from the target.
+			from = v.FinalURL
+		}
+		for _, link := range sortedURLs(v.Links) {
+			attrs := map[string]string{"style": "bold"}
+			if v.IsExternal(link) {
+				attrs = map[string]string{"style": "dashed", "color": "#888888"}
+				d.node(link, externalNodeAttrs(link))
+			} else {
+				d.node(link, GraphvizURL{link}.NodeAttrs())
+			}
+			d.edge(from, link, attrs)
 		}
-		for asset := range v.Assets {
-			asset := GraphvizURL{asset}
-			g.AddNode("G", asset.String(), asset.NodeAttrs())
-			m.MakeNewEdge(g, k.String(), asset.String(), map[string]string{"style": "dashed"})
+		for _, asset := range sortedURLs(v.Assets) {
+			if v.IsExternal(asset) {
+				d.node(asset, externalNodeAttrs(asset))
+			} else {
+				d.node(asset, GraphvizURL{asset}.NodeAttrs())
+			}
+			d.edge(from, asset, map[string]string{"style": "dashed"})
 		}
 	}
 
-	var root string
-	for k := range crawled {
-		root = k.Host
-		break
+	var ids map[url.URL]string
+	if m.Cluster {
+		ids = m.addClusteredNodes(g, Root(crawled), d.nodes)
+	} else {
+		ids = make(map[url.URL]string, len(d.nodes))
+		for _, u := range d.urls() {
+			ids[u] = GraphvizURL{u}.ID()
+			g.AddNode("G", ids[u], d.nodes[u])
+		}
+	}
+	for _, e := range d.edges {
+		m.MakeNewEdge(g, ids[e.from], ids[e.to], e.attrs)
 	}
+	return g
+}
 
-	ioutil.WriteFile("out/"+root+".dot", []byte(g.String()), 0777)
+// A drawing collects the nodes and edges of a graph before they are added
+// to it, so each node is added once, to the right cluster.
+type drawing struct {
+	nodes map[url.URL]map[string]string
+	edges []drawingEdge
+}
 
-	cmd := exec.Command("dot", "-v", "-Tpdf", "out/"+root+".dot", "-O")
-	cmd.Dir, _ = os.Getwd()
-	_, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Could not make pdf: %s\n Is dot installed? \n", err.Error())
+type drawingEdge struct {
+	from, to url.URL
+	attrs    map[string]string
+}
+
+// node draws u with attrs, unless it is already drawn.
+func (d *drawing) node(u url.URL, attrs map[string]string) {
+	if _, ok := d.nodes[u]; !ok {
+		d.nodes[u] = attrs
+	}
+}
+
+func (d *drawing) edge(from, to url.URL, attrs map[string]string) {
+	d.edges = append(d.edges, drawingEdge{from, to, attrs})
+}
+
+// redirectEdges draws each hop of r's redirect chain, labelled with its status.
+func (d *drawing) redirectEdges(r resource.Resource) {
+	for i, hop := range r.Redirects {
+		to := r.FinalURL
+		if i+1 < len(r.Redirects) {
+			to = r.Redirects[i+1].URL
+		}
+		for _, u := range []url.URL{hop.URL, to} {
+			d.node(u, GraphvizURL{u}.NodeAttrs())
+		}
+		d.edge(hop.URL, to, map[string]string{
+			"style": "dotted",
+			"color": "#3366CC",
+			"label": strconv.Itoa(hop.Status),
+		})
+	}
+}
+
+// urls returns the URLs of the drawn nodes, sorted.
+func (d *drawing) urls() []url.URL {
+	urls := make(map[url.URL]bool, len(d.nodes))
+	for u := range d.nodes {
+		urls[u] = true
+	}
+	return sortedURLs(urls)
+}
+
+// resourceNodeAttrs returns an attribute map for a crawled URL, showing how it was crawled.
+func resourceNodeAttrs(v resource.Resource) map[string]string {
+	attrs := GraphvizURL{v.URL}.NodeAttrs()
+	xlabel := fmt.Sprintf("depth %d", v.Depth)
+	var tooltip string
+	if v.Status != 0 {
+		xlabel += fmt.Sprintf(", %d", v.Status)
+		tooltip = fmt.Sprintf("%d %s, %d bytes, TTFB %s, total %s", v.Status, v.ContentType, v.Bytes, v.TTFB, v.Duration)
+	}
+	if v.Status >= 400 || v.Error != "" {
+		attrs["color"] = "#CC0000"
+		attrs["penwidth"] = "3"
+	}
+	if v.Error != "" {
+		tooltip = v.Error
+	}
+	if v.RobotsDisallowed {
+		attrs["style"] = "filled,dashed"
+		attrs["fontcolor"] = "#888888"
+		xlabel += " (robots.txt)"
+	}
+	if v.External {
+		attrs["style"] = "filled,dotted"
+		attrs["fillcolor"] = "#FFFFFF"
+		xlabel += " (external)"
+	}
+	attrs["xlabel"] = quoteID(xlabel)
+	if tooltip != "" {
+		attrs["tooltip"] = quoteID(tooltip)
 	}
+	return attrs
 }
@@ -0,0 +1,122 @@
+package sitemap
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	gv "github.com/geotho/gographviz"
+)
+
+// addClusteredNodes adds nodes to g, each in the cluster for its directory,
+// and returns the ID each URL was drawn as. Collapsed assets share the ID of
+// their cluster's "N more assets" node.
+func (m *GraphvizSiteMap) addClusteredNodes(g *gv.Graph, root string, nodes map[url.URL]map[string]string) map[url.URL]string {
+	members := make(map[string][]url.URL)
+	for u := range nodes {
+		key := m.clusterKey(u, root)
+		members[key] = append(members[key], u)
+	}
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ids := make(map[url.URL]string, len(nodes))
+	made := map[string]bool{"": true}
+	for _, key := range keys {
+		m.addCluster(g, key, made)
+		parent := clusterID(key)
+
+		urls := members[key]
+		sort.Slice(urls, func(i, j int) bool {
+			return urls[i].String() < urls[j].String()
+		})
+		assets := 0
+		for _, u := range urls {
+			if Kind(u) != KindPage {
+				assets++
+			}
+		}
+
+		drawn, collapsed := 0, quoteID("more assets in cluster_"+key)
+		for _, u := range urls {
+			if Kind(u) != KindPage && m.MaxAssets > 0 && assets > m.MaxAssets {
+				if drawn == m.MaxAssets {
+					ids[u] = collapsed
+					continue
+				}
+				drawn++
+			}
+			ids[u] = GraphvizURL{u}.ID()
+			g.AddNode(parent, ids[u], nodes[u])
+		}
+		if m.MaxAssets > 0 && assets > m.MaxAssets {
+			g.AddNode(parent, collapsed, map[string]string{
+				"label": quoteID(fmt.Sprintf("%d more assets", assets-m.MaxAssets)),
+				"shape": "note",
+				"style": "dashed",
+			})
+		}
+	}
+	return ids
+}
+
+// addCluster adds the cluster for key to g, nested in the clusters of its
+// parent directories, unless made says it has been added already.
+func (m *GraphvizSiteMap) addCluster(g *gv.Graph, key string, made map[string]bool) {
+	if made[key] {
+		return
+	}
+	parent := ""
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		parent = key[:i]
+	}
+	m.addCluster(g, parent, made)
+	g.AddSubGraph(clusterID(parent), clusterID(key), map[string]string{
+		"label":     quoteID(clusterLabel(key)),
+		"style":     "rounded",
+		"color":     "#AAAAAA",
+		"fontcolor": "#666666",
+	})
+	made[key] = true
+}
+
+// clusterKey returns the directories of u, up to ClusterDepth, joined by
+// slashes, e.g. "wp-content/uploads". URLs not on root are prefixed by their host.
+func (m *GraphvizSiteMap) clusterKey(u url.URL, root string) string {
+	var dirs []string
+	for _, d := range strings.Split(path.Dir(u.Path), "/") {
+		if d != "" && d != "." {
+			dirs = append(dirs, d)
+		}
+	}
+	if m.ClusterDepth > 0 && len(dirs) > m.ClusterDepth {
+		dirs = dirs[:m.ClusterDepth]
+	}
+	if u.Host != root {
+		dirs = append([]string{u.Host}, dirs...)
+	}
+	return strings.Join(dirs, "/")
+}
+
+// clusterID returns the ID of the subgraph for a cluster key. The empty key is the whole graph.
+func clusterID(key string) string {
+	if key == "" {
+		return "G"
+	}
+	return quoteID("cluster_" + key)
+}
+
+// clusterLabel returns the label of the cluster for key: its last directory.
+func clusterLabel(key string) string {
+	return key[strings.LastIndex(key, "/")+1:] + "/"
+}
+
+// quoteID quotes s as a Graphviz ID.
+func quoteID(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
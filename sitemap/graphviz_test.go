@@ -0,0 +1,83 @@
+package sitemap
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphvizURLID(t *testing.T) {
+	assert.Equal(t, `"http://google.com/a-b"`, GraphvizURL{parseURL("http://google.com/a-b")}.ID())
+	assert.Equal(t, `"http://google.com/?q=\"x\""`, GraphvizURL{parseURL(`http://google.com/?q="x"`)}.ID())
+}
+
+func TestGraphvizSiteMapCollidingURLs(t *testing.T) {
+	// All of these had the same ID, httpgooglecomab, so were drawn as one node.
+	urls := []string{"http://google.com/a-b", "http://google.com/ab", "https://google.com/ab", "http://google.com/a.b"}
+	crawled := make(map[url.URL]resource.Resource)
+	for _, u := range urls {
+		crawled[parseURL(u)] = resource.Resource{URL: parseURL(u), Status: 200, Links: makeURLMap(urls...)}
+	}
+
+	dot := (&GraphvizSiteMap{}).Graph(crawled).String()
+	for _, from := range urls {
+		assert.Contains(t, dot, `"`+from+`" [`)
+		for _, to := range urls {
+			assert.Contains(t, dot, `"`+from+`"->"`+to+`"`)
+		}
+	}
+	assert.Equal(t, len(urls)*len(urls), strings.Count(dot, "->"))
+}
+
+func TestGraphvizSiteMapQuotesText(t *testing.T) {
+	page := resource.Resource{
+		URL:         parseURL("http://google.com/"),
+		Depth:       2,
+		Status:      200,
+		ContentType: "text/html; charset=utf-8",
+		Bytes:       10,
+	}
+	missing := resource.Resource{URL: parseURL("http://google.com/gone"), Depth: 3, Error: `Get "http://google.com/gone": EOF`}
+	crawled := map[url.URL]resource.Resource{page.URL: page, missing.URL: missing}
+
+	dot := (&GraphvizSiteMap{}).Graph(crawled).String()
+	assert.Contains(t, dot, `label="http://google.com/"`)
+	assert.Contains(t, dot, `xlabel="depth 2, 200"`)
+	assert.Contains(t, dot, `tooltip="200 text/html; charset=utf-8, 10 bytes, TTFB 0s, total 0s"`)
+	assert.Contains(t, dot, `tooltip="Get \"http://google.com/gone\": EOF"`)
+	assert.NotContains(t, dot, "=depth")
+}
+
+func TestGraphvizSiteMapClusters(t *testing.T) {
+	page := resource.Resource{
+		URL:   parseURL("http://google.com/"),
+		Links: makeURLMap("http://google.com/blog/", "http://google.com/blog/2015/10/post", "http://bing.com/search"),
+		Assets: makeURLMap(
+			"http://google.com/wp-content/uploads/2015/10/a.jpg",
+			"http://google.com/wp-content/uploads/2015/10/b.jpg",
+			"http://google.com/wp-content/uploads/2015/10/c.jpg",
+			"http://google.com/wp-content/uploads/2015/11/d.jpg",
+		),
+	}
+	crawled := map[url.URL]resource.Resource{page.URL: page}
+
+	m := &GraphvizSiteMap{Cluster: true, ClusterDepth: 3, MaxAssets: 1}
+	dot := m.Graph(crawled).String()
+
+	for _, cluster := range []string{"cluster_blog", "cluster_blog/2015", "cluster_wp-content", "cluster_wp-content/uploads", "cluster_wp-content/uploads/2015", "cluster_bing.com"} {
+		assert.Contains(t, dot, `subgraph "`+cluster+`" {`)
+	}
+	// Clusters stop at ClusterDepth, so assets in /wp-content/uploads/2015/10/ are in /wp-content/uploads/2015/.
+	assert.Contains(t, dot, `subgraph "cluster_blog/2015/10" {`)
+	assert.NotContains(t, dot, "cluster_wp-content/uploads/2015/10")
+
+	// One of the four assets in /wp-content/uploads/2015/ is drawn, and the rest collapsed.
+	assert.Contains(t, dot, `"http://google.com/wp-content/uploads/2015/10/a.jpg"`)
+	assert.NotContains(t, dot, `"http://google.com/wp-content/uploads/2015/10/b.jpg"`)
+	assert.Contains(t, dot, `label="3 more assets"`)
+	assert.Contains(t, dot, `"http://google.com/"->"more assets in cluster_wp-content/uploads/2015"`)
+	assert.Equal(t, 1, strings.Count(dot, `"http://google.com/"->"more assets in cluster_wp-content/uploads/2015"`))
+}
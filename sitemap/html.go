@@ -0,0 +1,73 @@
+package sitemap
+
+import (
+	"html/template"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// An HTMLSiteMap writes a single, self-contained HTML page for exploring a
+// crawl offline: a force-directed graph that can be searched, filtered by
+// kind and zoomed, a panel inspecting the clicked URL, and a sortable table.
+type HTMLSiteMap struct{}
+
+type htmlReport struct {
+	Title string     `json:"title"`
+	Nodes []htmlNode `json:"nodes"`
+	Edges []htmlEdge `json:"edges"`
+}
+
+type htmlNode struct {
+	jsonResource
+	Kind    string `json:"kind"`
+	Crawled bool   `json:"crawled"`
+	// Links and Assets are indices into the nodes.
+	Links  []int `json:"links"`
+	Assets []int `json:"assets"`
+}
+
+type htmlEdge struct {
+	Source int    `json:"source"`
+	Target int    `json:"target"`
+	Kind   string `json:"kind"`
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(htmlReportSource))
+
+// SiteMap writes the report to dir/siteroot.html.
+func (m *HTMLSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return m.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes the report to dir/name.html.
+func (m *HTMLSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, name+".html"), m, crawled)
+}
+
+// Encode writes the report to w.
+func (m *HTMLSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	g := newGraph(crawled)
+	report := htmlReport{Title: Root(crawled), Nodes: []htmlNode{}, Edges: []htmlEdge{}}
+	for _, n := range g.nodes {
+		report.Nodes = append(report.Nodes, htmlNode{
+			jsonResource: newJSONResource(n.Resource),
+			Kind:         Kind(n.URL),
+			Crawled:      n.Crawled,
+			Links:        []int{},
+			Assets:       []int{},
+		})
+	}
+	for _, e := range g.edges {
+		report.Edges = append(report.Edges, htmlEdge{Source: e.From, Target: e.To, Kind: e.Kind})
+		switch e.Kind {
+		case EdgeLink:
+			report.Nodes[e.From].Links = append(report.Nodes[e.From].Links, e.To)
+		case EdgeAsset:
+			report.Nodes[e.From].Assets = append(report.Nodes[e.From].Assets, e.To)
+		}
+	}
+	return htmlReportTemplate.Execute(w, report)
+}
@@ -0,0 +1,389 @@
+package sitemap
+
+// htmlReportSource is the template of the HTMLSiteMap report. It must not
+// load anything from the network, so the report works offline.
+const htmlReportSource = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} sitemap</title>
+<style>
+* { box-sizing: border-box; }
+body { margin: 0; font: 13px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; display: flex; flex-direction: column; height: 100vh; }
+header { display: flex; gap: 12px; align-items: center; padding: 8px 12px; border-bottom: 1px solid #ccc; background: #f6f6f6; flex-wrap: wrap; }
+header h1 { font-size: 16px; margin: 0 12px 0 0; }
+header input[type=search] { width: 280px; padding: 4px 6px; }
+header label { white-space: nowrap; }
+.swatch { display: inline-block; width: 10px; height: 10px; border-radius: 50%; margin-right: 3px; border: 1px solid #888; }
+.tabs button { padding: 4px 10px; border: 1px solid #aaa; background: #fff; cursor: pointer; }
+.tabs button.active { background: #333; color: #fff; }
+main { flex: 1; display: flex; min-height: 0; }
+#graph-view, #table-view { flex: 1; min-width: 0; position: relative; }
+#table-view { overflow: auto; display: none; }
+canvas { display: block; width: 100%; height: 100%; cursor: grab; }
+#panel { width: 360px; border-left: 1px solid #ccc; overflow: auto; padding: 10px 12px; }
+#panel h2 { font-size: 14px; word-break: break-all; margin: 0 0 8px; }
+#panel table td { vertical-align: top; padding: 1px 6px 1px 0; }
+#panel ul { padding-left: 18px; margin: 4px 0 10px; }
+#panel li { word-break: break-all; }
+a.node { color: #0645ad; cursor: pointer; text-decoration: none; }
+a.node:hover { text-decoration: underline; }
+.bad { color: #c00; font-weight: bold; }
+.muted { color: #888; }
+#pages { border-collapse: collapse; width: 100%; }
+#pages th, #pages td { border-bottom: 1px solid #e4e4e4; padding: 4px 8px; text-align: left; white-space: nowrap; }
+#pages td:first-child { white-space: normal; word-break: break-all; }
+#pages th { position: sticky; top: 0; background: #f6f6f6; cursor: pointer; user-select: none; }
+#pages th.asc::after { content: " \25B2"; }
+#pages th.desc::after { content: " \25BC"; }
+#pages tr:hover td { background: #fafae0; }
+</style>
+</head>
+<body>
+<header>
+  <h1>{{.Title}}</h1>
+  <input type="search" id="search" placeholder="Search URLs">
+  <span id="kinds"></span>
+  <span class="tabs"><button id="show-graph" class="active">Graph</button><button id="show-table">Table</button></span>
+  <span id="summary" class="muted"></span>
+</header>
+<main>
+  <div id="graph-view"><canvas id="canvas"></canvas></div>
+  <div id="table-view">
+    <table id="pages">
+      <thead><tr>
+        <th data-key="url">URL</th><th data-key="kind">Kind</th><th data-key="status">Status</th><th data-key="depth">Depth</th>
+        <th data-key="content_type">Type</th><th data-key="bytes">Bytes</th><th data-key="ttfb_ms">TTFB (ms)</th><th data-key="duration_ms">Time (ms)</th>
+        <th data-key="links">Links</th><th data-key="assets">Assets</th>
+      </tr></thead>
+      <tbody></tbody>
+    </table>
+  </div>
+  <div id="panel"><p class="muted">Click a node or table row to inspect it. Scroll to zoom, drag to pan.</p></div>
+</main>
+<script>
+(function() {
+"use strict";
+var report = {{.}};
+var nodes = report.nodes, edges = report.edges;
+var colours = {page: "#DDDDDD", image: "#FFC6BC", script: "#A7D3D2", stylesheet: "#F7A541", other: "#A9DA88"};
+var shown = {page: true, image: true, script: true, stylesheet: true, other: true};
+var query = "", selected = null;
+
+// Filters.
+var kinds = document.getElementById("kinds");
+Object.keys(colours).forEach(function(kind) {
+  var label = document.createElement("label");
+  var box = document.createElement("input");
+  box.type = "checkbox";
+  box.checked = true;
+  box.onchange = function() { shown[kind] = box.checked; refresh(); };
+  var swatch = document.createElement("span");
+  swatch.className = "swatch";
+  swatch.style.background = colours[kind];
+  label.appendChild(box);
+  label.appendChild(swatch);
+  label.appendChild(document.createTextNode(kind + " "));
+  kinds.appendChild(label);
+});
+
+function visible(n) { return shown[n.kind]; }
+function matches(n) { return query === "" || n.url.toLowerCase().indexOf(query) >= 0; }
+function broken(n) { return n.error || n.status >= 400; }
+
+document.getElementById("search").oninput = function(e) {
+  query = e.target.value.toLowerCase();
+  refresh();
+};
+document.getElementById("search").onkeydown = function(e) {
+  if (e.key !== "Enter") return;
+  for (var i = 0; i < nodes.length; i++) {
+    if (visible(nodes[i]) && matches(nodes[i])) { inspect(i); centre(nodes[i]); return; }
+  }
+};
+
+// Tabs.
+var graphTab = document.getElementById("show-graph"), tableTab = document.getElementById("show-table");
+graphTab.onclick = function() { showTab(true); };
+tableTab.onclick = function() { showTab(false); };
+function showTab(graph) {
+  document.getElementById("graph-view").style.display = graph ? "block" : "none";
+  document.getElementById("table-view").style.display = graph ? "none" : "block";
+  graphTab.className = graph ? "active" : "";
+  tableTab.className = graph ? "" : "active";
+  if (graph) resize();
+}
+
+// Inspect panel.
+var panel = document.getElementById("panel");
+function esc(s) {
+  return String(s).replace(/[&<>"]/g, function(c) { return {"&": "&amp;", "<": "&lt;", ">": "&gt;", "\"": "&quot;"}[c]; });
+}
+function nodeLink(i) {
+  var n = nodes[i];
+  return "<a class=\"node" + (broken(n) ? " bad" : "") + "\" data-node=\"" + i + "\">" + esc(n.url) + "</a>" +
+    (n.status ? " <span class=\"muted\">" + n.status + "</span>" : "");
+}
+function list(title, ids) {
+  if (!ids.length) return "<h3>" + title + " (0)</h3>";
+  return "<h3>" + title + " (" + ids.length + ")</h3><ul><li>" + ids.map(nodeLink).join("</li><li>") + "</li></ul>";
+}
+function inspect(i) {
+  selected = i;
+  var n = nodes[i];
+  var rows = [
+    ["Kind", n.kind], ["Depth", n.crawled ? n.depth : ""], ["Status", n.status || ""], ["Type", n.content_type || ""],
+    ["Bytes", n.crawled ? n.bytes : ""], ["TTFB", n.ttfb_ms ? n.ttfb_ms.toFixed(1) + " ms" : ""], ["Time", n.duration_ms ? n.duration_ms.toFixed(1) + " ms" : ""],
+    ["Error", n.error || ""], ["Final URL", n.final_url || ""]
+  ];
+  if (!n.crawled) rows.push(["Crawled", "no"]);
+  if (n.external) rows.push(["External", "yes"]);
+  if (n.robots_disallowed) rows.push(["robots.txt", "disallowed"]);
+  if (n.via_sitemap) rows.push(["Reached", "via sitemap only"]);
+  Object.keys(n.header || {}).sort().forEach(function(h) { rows.push([h, n.header[h].join(", ")]); });
+
+  var from = [];
+  edges.forEach(function(e) { if (e.target === i && e.kind !== "redirect") from.push(e.source); });
+  panel.innerHTML = "<h2>" + esc(n.url) + "</h2><table>" +
+    rows.filter(function(r) { return r[1] !== ""; }).map(function(r) {
+      return "<tr><td class=\"muted\">" + esc(r[0]) + "</td><td" + (r[0] === "Error" || (r[0] === "Status" && r[1] >= 400) ? " class=\"bad\"" : "") + ">" + esc(r[1]) + "</td></tr>";
+    }).join("") + "</table>" +
+    (n.redirects ? "<h3>Redirects</h3><ul>" + n.redirects.map(function(r) { return "<li>" + r.status + " " + esc(r.url) + "</li>"; }).join("") + "</ul>" : "") +
+    list("Links", n.links) + list("Assets", n.assets) + list("Referenced by", from);
+  draw();
+}
+panel.onclick = function(e) {
+  var i = e.target.getAttribute("data-node");
+  if (i !== null) { inspect(+i); centre(nodes[+i]); }
+};
+
+// Table.
+var tbody = document.querySelector("#pages tbody");
+var sortKey = "url", sortDir = 1;
+document.querySelectorAll("#pages th").forEach(function(th) {
+  th.onclick = function() {
+    var key = th.getAttribute("data-key");
+    sortDir = key === sortKey ? -sortDir : 1;
+    sortKey = key;
+    table();
+  };
+});
+function value(n, key) {
+  var v = n[key];
+  if (Array.isArray(v)) return v.length;
+  return v === undefined ? "" : v;
+}
+function table() {
+  var rows = [];
+  nodes.forEach(function(n, i) { if (n.crawled && visible(n) && matches(n)) rows.push(i); });
+  rows.sort(function(a, b) {
+    var x = value(nodes[a], sortKey), y = value(nodes[b], sortKey);
+    return (x < y ? -1 : x > y ? 1 : 0) * sortDir;
+  });
+  document.querySelectorAll("#pages th").forEach(function(th) {
+    th.className = th.getAttribute("data-key") === sortKey ? (sortDir > 0 ? "asc" : "desc") : "";
+  });
+  tbody.innerHTML = rows.map(function(i) {
+    var n = nodes[i];
+    return "<tr data-node=\"" + i + "\"><td>" + nodeLink(i) + "</td><td>" + n.kind + "</td><td" + (broken(n) ? " class=\"bad\"" : "") + ">" +
+      esc(n.error || n.status || "") + "</td><td>" + n.depth + "</td><td>" + esc(n.content_type || "") + "</td><td>" + n.bytes + "</td><td>" +
+      (n.ttfb_ms || 0).toFixed(1) + "</td><td>" + (n.duration_ms || 0).toFixed(1) + "</td><td>" + n.links.length + "</td><td>" + n.assets.length + "</td></tr>";
+  }).join("");
+}
+tbody.onclick = function(e) {
+  var tr = e.target.closest("tr");
+  if (tr) inspect(+tr.getAttribute("data-node"));
+};
+
+// Force-directed graph.
+var canvas = document.getElementById("canvas"), ctx = canvas.getContext("2d");
+var view = {x: 0, y: 0, k: 1}, ratio = window.devicePixelRatio || 1;
+var degree = nodes.map(function() { return 0; });
+edges.forEach(function(e) { degree[e.source]++; degree[e.target]++; });
+nodes.forEach(function(n, i) {
+  var a = i * 2.39996, r = 12 * Math.sqrt(i + 1);
+  n.x = r * Math.cos(a);
+  n.y = r * Math.sin(a);
+  n.vx = n.vy = 0;
+  n.r = n.kind === "page" ? 7 : 4;
+});
+
+// The layout is O(n²) a tick, so it stops once it settles or after
+// maxTicks, whichever is first. Dragging a node wakes it for a while.
+var alpha = 1, ticks = 0, maxTicks = 300, running = false;
+function tick() {
+  var i, j, a, b, dx, dy, d2, d, f, motion = 0;
+  var live = nodes.filter(visible);
+  for (i = 0; i < live.length; i++) {
+    a = live[i];
+    for (j = i + 1; j < live.length; j++) {
+      b = live[j];
+      dx = b.x - a.x; dy = b.y - a.y;
+      d2 = dx * dx + dy * dy || 0.01;
+      if (d2 > 250000) continue;
+      f = 400 * alpha / d2;
+      a.vx -= dx * f; a.vy -= dy * f;
+      b.vx += dx * f; b.vy += dy * f;
+    }
+  }
+  edges.forEach(function(e) {
+    a = nodes[e.source]; b = nodes[e.target];
+    if (!visible(a) || !visible(b)) return;
+    dx = b.x - a.x; dy = b.y - a.y;
+    d = Math.sqrt(dx * dx + dy * dy) || 0.01;
+    f = (d - (e.kind === "link" ? 60 : 30)) / d * 0.05 * alpha / Math.min(degree[e.source], degree[e.target]);
+    a.vx += dx * f; a.vy += dy * f;
+    b.vx -= dx * f; b.vy -= dy * f;
+  });
+  live.forEach(function(n) {
+    if (n === dragging) return;
+    n.vx -= n.x * 0.002 * alpha;
+    n.vy -= n.y * 0.002 * alpha;
+    n.x += n.vx; n.y += n.vy;
+    motion += n.vx * n.vx + n.vy * n.vy;
+    n.vx *= 0.6; n.vy *= 0.6;
+  });
+  alpha *= 0.99;
+  ticks++;
+  return live.length ? motion / live.length : 0;
+}
+
+function resize() {
+  canvas.width = canvas.clientWidth * ratio;
+  canvas.height = canvas.clientHeight * ratio;
+  draw();
+}
+window.onresize = resize;
+
+function draw() {
+  ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+  ctx.translate(canvas.clientWidth / 2 + view.x, canvas.clientHeight / 2 + view.y);
+  ctx.scale(view.k, view.k);
+
+  edges.forEach(function(e) {
+    var a = nodes[e.source], b = nodes[e.target];
+    if (!visible(a) || !visible(b)) return;
+    var hot = selected === e.source || selected === e.target;
+    ctx.strokeStyle = e.kind === "redirect" ? "#3366CC" : hot ? "#333" : e.kind === "link" ? "rgba(0,0,0,0.25)" : "rgba(0,0,0,0.1)";
+    ctx.lineWidth = (hot ? 2 : 1) / view.k;
+    ctx.setLineDash(e.kind === "link" ? [] : [4 / view.k, 3 / view.k]);
+    ctx.beginPath();
+    ctx.moveTo(a.x, a.y);
+    ctx.lineTo(b.x, b.y);
+    ctx.stroke();
+  });
+  ctx.setLineDash([]);
+
+  nodes.forEach(function(n, i) {
+    if (!visible(n)) return;
+    ctx.globalAlpha = matches(n) ? 1 : 0.15;
+    ctx.beginPath();
+    ctx.arc(n.x, n.y, n.r, 0, 2 * Math.PI);
+    ctx.fillStyle = n.external ? "#FFFFFF" : colours[n.kind];
+    ctx.fill();
+    ctx.lineWidth = (i === selected ? 3 : broken(n) ? 2 : 1) / view.k;
+    ctx.strokeStyle = i === selected ? "#000" : broken(n) ? "#CC0000" : "#777";
+    ctx.stroke();
+    if (i === selected || (query !== "" && matches(n)) || view.k > 2.5) {
+      ctx.fillStyle = "#222";
+      ctx.font = 11 / view.k + "px sans-serif";
+      ctx.fillText(n.url, n.x + n.r + 2 / view.k, n.y + 4 / view.k);
+    }
+  });
+  ctx.globalAlpha = 1;
+}
+
+function animate() {
+  var motion = tick();
+  draw();
+  if (alpha > 0.005 && ticks < maxTicks && motion > 0.001) {
+    window.requestAnimationFrame(animate);
+  } else {
+    running = false;
+  }
+}
+function wake() {
+  alpha = Math.max(alpha, 0.1);
+  ticks = Math.min(ticks, maxTicks - 60);
+  if (!running) {
+    running = true;
+    window.requestAnimationFrame(animate);
+  }
+}
+
+function toGraph(e) {
+  var rect = canvas.getBoundingClientRect();
+  return {
+    x: (e.clientX - rect.left - canvas.clientWidth / 2 - view.x) / view.k,
+    y: (e.clientY - rect.top - canvas.clientHeight / 2 - view.y) / view.k
+  };
+}
+function nodeAt(p) {
+  for (var i = nodes.length - 1; i >= 0; i--) {
+    var n = nodes[i], dx = n.x - p.x, dy = n.y - p.y, r = n.r + 3 / view.k;
+    if (visible(n) && dx * dx + dy * dy <= r * r) return i;
+  }
+  return null;
+}
+function centre(n) {
+  view.x = -n.x * view.k;
+  view.y = -n.y * view.k;
+  draw();
+}
+
+var dragging = null, panning = null, moved = false;
+canvas.onmousedown = function(e) {
+  var i = nodeAt(toGraph(e));
+  moved = false;
+  if (i !== null) dragging = nodes[i];
+  else panning = {x: e.clientX - view.x, y: e.clientY - view.y};
+};
+window.onmousemove = function(e) {
+  if (dragging) {
+    var p = toGraph(e);
+    dragging.x = p.x; dragging.y = p.y;
+    wake();
+    moved = true;
+    draw();
+  } else if (panning) {
+    view.x = e.clientX - panning.x;
+    view.y = e.clientY - panning.y;
+    moved = true;
+    draw();
+  }
+};
+window.onmouseup = function(e) {
+  if (!moved && e.target === canvas) {
+    var i = nodeAt(toGraph(e));
+    if (i !== null) inspect(i);
+  }
+  dragging = panning = null;
+};
+canvas.onwheel = function(e) {
+  e.preventDefault();
+  var p = toGraph(e), k = view.k * Math.pow(1.0015, -e.deltaY);
+  k = Math.max(0.05, Math.min(20, k));
+  view.x -= p.x * (k - view.k);
+  view.y -= p.y * (k - view.k);
+  view.k = k;
+  draw();
+};
+
+function refresh() {
+  table();
+  draw();
+}
+
+var pages = nodes.filter(function(n) { return n.crawled; }).length;
+var bad = nodes.filter(broken).length;
+document.getElementById("summary").textContent = pages + " crawled, " + nodes.length + " URLs, " + edges.length + " edges" + (bad ? ", " + bad + " broken" : "");
+table();
+resize();
+view.k = Math.min(1, 30 / Math.sqrt(nodes.length + 1));
+wake();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,65 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLSiteMap(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&HTMLSiteMap{}).Encode(b, jsonTestCrawl()))
+
+	s := b.String()
+	assert.Contains(t, s, "<title>google.com sitemap</title>")
+	assert.Contains(t, s, `"url":"http://google.com/cat.png"`)
+	assert.Contains(t, s, `"kind":"image"`)
+	assert.Contains(t, s, `"links":[3],"assets":[1]`)
+	assert.NotContains(t, s, "src=", "the report must not load anything")
+	assert.NotContains(t, s, "<link")
+}
+
+func TestHTMLSiteMapData(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&HTMLSiteMap{}).Encode(b, jsonTestCrawl()))
+
+	s := b.String()
+	start := strings.Index(s, "var report = ")
+	end := strings.Index(s, ";\nvar nodes")
+	if !assert.True(t, start >= 0 && end > start, "the report must embed its data") {
+		return
+	}
+	var report struct {
+		Title string `json:"title"`
+		Nodes []struct {
+			URL     string `json:"url"`
+			Kind    string `json:"kind"`
+			Crawled bool   `json:"crawled"`
+			Status  int    `json:"status"`
+			Links   []int  `json:"links"`
+			Assets  []int  `json:"assets"`
+		} `json:"nodes"`
+		Edges []htmlEdge `json:"edges"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(s[start+len("var report = "):end]), &report))
+
+	assert.Equal(t, "google.com", report.Title)
+	var urls []string
+	for _, n := range report.Nodes {
+		urls = append(urls, n.URL)
+	}
+	assert.Equal(t, []string{"http://google.com/", "http://google.com/cat.png", "http://google.com/new", "http://google.com/old"}, urls)
+	assert.Equal(t, "image", report.Nodes[1].Kind)
+	assert.False(t, report.Nodes[1].Crawled)
+	assert.Equal(t, 404, report.Nodes[3].Status)
+	assert.Equal(t, []int{3}, report.Nodes[0].Links)
+	assert.Equal(t, []int{1}, report.Nodes[0].Assets)
+	assert.Equal(t, []htmlEdge{
+		{Source: 0, Target: 3, Kind: EdgeLink},
+		{Source: 0, Target: 1, Kind: EdgeAsset},
+		{Source: 3, Target: 2, Kind: EdgeRedirect},
+	}, report.Edges)
+}
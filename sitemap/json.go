@@ -0,0 +1,218 @@
+package sitemap
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// A JSONSiteMap writes the whole crawl graph as one JSON document: a node
+// for each URL with all its metadata, and an edge for each link, asset and
+// redirect. URLs that were referenced but not crawled have nodes too.
+type JSONSiteMap struct{}
+
+// A JSONLinesSiteMap writes one line of JSON for each crawled URL, including
+// its links and assets. Use a JSONLinesWriter to write lines during a crawl.
+type JSONLinesSiteMap struct{}
+
+type jsonGraph struct {
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+type jsonNode struct {
+	jsonResource
+	// Crawled is false for URLs that were referenced but not crawled.
+	Crawled bool `json:"crawled"`
+}
+
+type jsonEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Type is EdgeLink, EdgeAsset or EdgeRedirect.
+	Type string `json:"type"`
+	// Element is the kind of element referencing To, for links and assets.
+	Element string `json:"element,omitempty"`
+	// Status is the redirect response status, for redirects.
+	Status int `json:"status,omitempty"`
+}
+
+type jsonResource struct {
+	URL              string         `json:"url"`
+	Depth            int            `json:"depth"`
+	External         bool           `json:"external,omitempty"`
+	ViaSitemap       bool           `json:"via_sitemap,omitempty"`
+	RobotsDisallowed bool           `json:"robots_disallowed,omitempty"`
+	FinalURL         string         `json:"final_url,omitempty"`
+	Redirects        []jsonRedirect `json:"redirects,omitempty"`
+	Status           int            `json:"status,omitempty"`
+	Header           http.Header    `json:"header,omitempty"`
+	ContentType      string         `json:"content_type,omitempty"`
+	ContentLength    int64          `json:"content_length,omitempty"`
+	Bytes            int64          `json:"bytes"`
+	TTFB             float64        `json:"ttfb_ms,omitempty"`
+	Duration         float64        `json:"duration_ms,omitempty"`
+	Error            string         `json:"error,omitempty"`
+}
+
+type jsonRedirect struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+type jsonLine struct {
+	jsonResource
+	Links  []string   `json:"links"`
+	Assets []jsonLink `json:"assets"`
+}
+
+type jsonLink struct {
+	URL     string `json:"url"`
+	Element string `json:"element"`
+}
+
+// SiteMap writes the crawl graph to dir/siteroot.json.
+func (j *JSONSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return j.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes the crawl graph to dir/name.json.
+func (j *JSONSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, name+".json"), j, crawled)
+}
+
+// Encode writes the crawl graph to w as indented JSON, sorted by URL.
+func (j *JSONSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	g := jsonGraph{Nodes: []jsonNode{}, Edges: []jsonEdge{}}
+	graph := newGraph(crawled)
+	for _, n := range graph.nodes {
+		g.Nodes = append(g.Nodes, jsonNode{jsonResource: newJSONResource(n.Resource), Crawled: n.Crawled})
+	}
+	for _, e := range graph.edges {
+		g.Edges = append(g.Edges, jsonEdge{
+			From:    graph.nodes[e.From].URL.String(),
+			To:      graph.nodes[e.To].URL.String(),
+			Type:    e.Kind,
+			Element: e.Element,
+			Status:  e.Status,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// SiteMap writes a line for each crawled URL to dir/siteroot.jsonl.
+func (j *JSONLinesSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return j.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes a line for each crawled URL to dir/name.jsonl.
+func (j *JSONLinesSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, name+".jsonl"), j, crawled)
+}
+
+// Encode writes a line for each crawled URL to w, sorted by URL.
+func (j *JSONLinesSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	lines := NewJSONLinesWriter(w)
+	for _, r := range sortedResources(crawled) {
+		lines.Write(r)
+	}
+	return lines.Err()
+}
+
+// A JSONLinesWriter writes Resources to an io.Writer as lines of JSON, as
+// written by JSONLinesSiteMap. Pass its Write method as crawler.Options.OnResource
+// to stream a crawl as it happens. It may be used from several goroutines
+// at once, e.g. by the Crawlers of several sites.
+type JSONLinesWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONLinesWriter returns a JSONLinesWriter writing to w.
+func NewJSONLinesWriter(w io.Writer) *JSONLinesWriter {
+	return &JSONLinesWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes r as one line of JSON. Once a write fails, Write does
+// nothing more and Err returns the error.
+func (j *JSONLinesWriter) Write(r resource.Resource) {
+	line := jsonLine{jsonResource: newJSONResource(r), Links: URLMapToStringSlice(r.Links), Assets: []jsonLink{}}
+	for _, a := range sortedURLs(r.Assets) {
+		line.Assets = append(line.Assets, jsonLink{URL: a.String(), Element: r.Element(a)})
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err == nil {
+		j.err = j.enc.Encode(line)
+	}
+}
+
+// Err returns the first error writing a line, if any.
+func (j *JSONLinesWriter) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+func newJSONResource(r resource.Resource) jsonResource {
+	j := jsonResource{
+		URL:              r.URL.String(),
+		Depth:            r.Depth,
+		External:         r.External,
+		ViaSitemap:       r.ViaSitemap,
+		RobotsDisallowed: r.RobotsDisallowed,
+		Status:           r.Status,
+		Header:           r.Header,
+		ContentType:      r.ContentType,
+		ContentLength:    r.ContentLength,
+		Bytes:            r.Bytes,
+		TTFB:             milliseconds(r.TTFB),
+		Duration:         milliseconds(r.Duration),
+		Error:            r.Error,
+	}
+	if len(r.Redirects) > 0 {
+		j.FinalURL = r.FinalURL.String()
+		for _, hop := range r.Redirects {
+			j.Redirects = append(j.Redirects, jsonRedirect{URL: hop.URL.String(), Status: hop.Status})
+		}
+	}
+	return j
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// sortedResources returns the crawled Resources sorted by URL.
+func sortedResources(crawled map[url.URL]resource.Resource) Resources {
+	rs := make(Resources, 0, len(crawled))
+	for _, r := range crawled {
+		rs = append(rs, r)
+	}
+	sort.Sort(rs)
+	return rs
+}
+
+// sortedURLs returns the URLs in urlMap sorted.
+func sortedURLs(urlMap map[url.URL]bool) []url.URL {
+	us := make([]url.URL, 0, len(urlMap))
+	for u := range urlMap {
+		us = append(us, u)
+	}
+	sort.Slice(us, func(i, j int) bool {
+		return us[i].String() < us[j].String()
+	})
+	return us
+}
@@ -0,0 +1,101 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func jsonTestCrawl() map[url.URL]resource.Resource {
+	page := resource.Resource{
+		URL:         parseURL("http://google.com/"),
+		Links:       makeURLMap("http://google.com/old"),
+		Assets:      makeURLMap("http://google.com/cat.png"),
+		Elements:    map[url.URL]string{parseURL("http://google.com/cat.png"): resource.ElementImg},
+		Status:      200,
+		Header:      http.Header{"Server": {"gws"}},
+		ContentType: "text/html",
+		Bytes:       512,
+		TTFB:        1500 * time.Microsecond,
+		Duration:    3 * time.Millisecond,
+	}
+	old := resource.Resource{
+		URL:       parseURL("http://google.com/old"),
+		Depth:     1,
+		FinalURL:  parseURL("http://google.com/new"),
+		Redirects: []resource.Redirect{{URL: parseURL("http://google.com/old"), Status: 301}},
+		Status:    404,
+	}
+	return map[url.URL]resource.Resource{page.URL: page, old.URL: old}
+}
+
+func TestJSONSiteMap(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&JSONSiteMap{}).Encode(b, jsonTestCrawl()))
+	assert.JSONEq(t, `{
+		"nodes": [
+			{"url": "http://google.com/", "depth": 0, "crawled": true, "status": 200, "header": {"Server": ["gws"]}, "content_type": "text/html", "bytes": 512, "ttfb_ms": 1.5, "duration_ms": 3},
+			{"url": "http://google.com/cat.png", "depth": 0, "crawled": false, "bytes": 0},
+			{"url": "http://google.com/new", "depth": 0, "crawled": false, "bytes": 0},
+			{"url": "http://google.com/old", "depth": 1, "crawled": true, "final_url": "http://google.com/new", "redirects": [{"url": "http://google.com/old", "status": 301}], "status": 404, "bytes": 0}
+		],
+		"edges": [
+			{"from": "http://google.com/", "to": "http://google.com/old", "type": "link", "element": "a"},
+			{"from": "http://google.com/", "to": "http://google.com/cat.png", "type": "asset", "element": "img"},
+			{"from": "http://google.com/old", "to": "http://google.com/new", "type": "redirect", "status": 301}
+		]
+	}`, b.String())
+}
+
+func TestJSONSiteMapEdgesHaveNodes(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&JSONSiteMap{}).Encode(b, jsonTestCrawl()))
+	var g jsonGraph
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &g))
+	nodes := make(map[string]bool, len(g.Nodes))
+	for _, n := range g.Nodes {
+		nodes[n.URL] = true
+	}
+	for _, e := range g.Edges {
+		assert.True(t, nodes[e.From], "edge from %s has no node", e.From)
+		assert.True(t, nodes[e.To], "edge to %s has no node", e.To)
+	}
+}
+
+func TestJSONLinesSiteMap(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&JSONLinesSiteMap{}).Encode(b, jsonTestCrawl()))
+
+	lines := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n"))
+	if assert.Len(t, lines, 2) {
+		assert.JSONEq(t, `{"url": "http://google.com/", "depth": 0, "status": 200, "header": {"Server": ["gws"]}, "content_type": "text/html", "bytes": 512, "ttfb_ms": 1.5, "duration_ms": 3,
+			"links": ["http://google.com/old"], "assets": [{"url": "http://google.com/cat.png", "element": "img"}]}`, string(lines[0]))
+		assert.JSONEq(t, `{"url": "http://google.com/old", "depth": 1, "final_url": "http://google.com/new", "redirects": [{"url": "http://google.com/old", "status": 301}], "status": 404, "bytes": 0,
+			"links": [], "assets": []}`, string(lines[1]))
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, assert.AnError }
+
+func TestJSONLinesWriterStopsOnError(t *testing.T) {
+	w := NewJSONLinesWriter(failingWriter{})
+	w.Write(resource.Resource{URL: parseURL("http://google.com/")})
+	w.Write(resource.Resource{URL: parseURL("http://google.com/b")})
+	assert.Equal(t, assert.AnError, w.Err())
+}
+
+func makeURLMap(ss ...string) map[url.URL]bool {
+	m := make(map[url.URL]bool, len(ss))
+	for _, s := range ss {
+		m[parseURL(s)] = true
+	}
+	return m
+}
@@ -0,0 +1,111 @@
+// Package sitemap writes crawls out in formats for people, search engines and graph tools.
+package sitemap
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// A SiteMapper writes a sitemap of a crawl to files in an output directory.
+// Each file is named after the crawled site, e.g. dir/google.com.txt.
+type SiteMapper interface {
+	SiteMap(dir string, crawled map[url.URL]resource.Resource) error
+}
+
+// A NamedSiteMapper can name its files other than after the crawled site,
+// e.g. for a crawl of several sites. All the built-in formats can.
+type NamedSiteMapper interface {
+	SiteMapper
+	// SiteMapNamed writes the sitemap as SiteMap does, with each file named
+	// after name instead of the crawled site, e.g. dir/name.txt.
+	SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error
+}
+
+// An Encoder writes a sitemap that is a single file to any io.Writer.
+type Encoder interface {
+	Encode(w io.Writer, crawled map[url.URL]resource.Resource) error
+}
+
+var formats = map[string]func() SiteMapper{
+	"cytoscape": func() SiteMapper { return &CytoscapeSiteMap{} },
+	"gexf":      func() SiteMapper { return &GEXFSiteMap{} },
+	"graphml":   func() SiteMapper { return &GraphMLSiteMap{} },
+	"graphviz":  func() SiteMapper { return &GraphvizSiteMap{} },
+	"html":      func() SiteMapper { return &HTMLSiteMap{} },
+	"json":      func() SiteMapper { return &JSONSiteMap{} },
+	"jsonl":     func() SiteMapper { return &JSONLinesSiteMap{} },
+	"svg":       func() SiteMapper { return &SVGSiteMap{} },
+	"text":      func() SiteMapper { return &TextSiteMap{} },
+	"tree":      func() SiteMapper { return &TreeSiteMap{} },
+	"xml":       func() SiteMapper { return &XMLSiteMap{} },
+}
+
+// Register makes a format available to New under name, replacing any
+// format of that name. It is not safe to call concurrently with New, so
+// should be called from an init function.
+func Register(name string, newMapper func() SiteMapper) {
+	formats[name] = newMapper
+}
+
+// New returns a SiteMapper for the named format.
+func New(name string) (SiteMapper, error) {
+	newMapper, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sitemap format %q: choose from %s", name, strings.Join(Formats(), ", "))
+	}
+	return newMapper(), nil
+}
+
+// Formats returns the names of the registered formats, sorted.
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Root returns the host of the crawled site: that of its shallowest URL,
+// which is a seed, breaking ties by URL so it is the same every time. URLs
+// outside the crawl are only used if there are no others, so a crawl whose
+// seed was out of scope is still named after it.
+func Root(crawled map[url.URL]resource.Resource) string {
+	var root, external string
+	depth, externalDepth := -1, -1
+	for u, r := range crawled {
+		if r.External {
+			if externalDepth < 0 || r.Depth < externalDepth || (r.Depth == externalDepth && u.String() < external) {
+				external, externalDepth = u.String(), r.Depth
+			}
+			continue
+		}
+		if depth < 0 || r.Depth < depth || (r.Depth == depth && u.String() < root) {
+			root, depth = u.String(), r.Depth
+		}
+	}
+	if root == "" {
+		root = external
+	}
+	u, _ := url.Parse(root)
+	return u.Host
+}
+
+// writeFile writes crawled to path, encoded by e.
+func writeFile(path string, e Encoder, crawled map[url.URL]resource.Resource) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := e.Encode(f, crawled); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,66 @@
+package sitemap
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopSiteMap struct{}
+
+func (nopSiteMap) SiteMap(string, map[url.URL]resource.Resource) error { return nil }
+
+func TestNew(t *testing.T) {
+	m, err := New("text")
+	assert.NoError(t, err)
+	assert.IsType(t, &TextSiteMap{}, m)
+
+	_, err = New("nope")
+	assert.EqualError(t, err, `unknown sitemap format "nope": choose from cytoscape, gexf, graphml, graphviz, html, json, jsonl, svg, text, tree, xml`)
+
+	Register("nop", func() SiteMapper { return nopSiteMap{} })
+	defer delete(formats, "nop")
+	assert.Equal(t, []string{"cytoscape", "gexf", "graphml", "graphviz", "html", "json", "jsonl", "nop", "svg", "text", "tree", "xml"}, Formats())
+	m, err = New("nop")
+	assert.NoError(t, err)
+	assert.Equal(t, nopSiteMap{}, m)
+}
+
+func TestRoot(t *testing.T) {
+	crawled := map[url.URL]resource.Resource{
+		parseURL("http://bing.com/"):        {URL: parseURL("http://bing.com/"), External: true},
+		parseURL("http://google.com/"):      {URL: parseURL("http://google.com/")},
+		parseURL("http://maps.google.com/"): {URL: parseURL("http://maps.google.com/"), Depth: 1},
+	}
+	assert.Equal(t, "google.com", Root(crawled))
+
+	external := map[url.URL]resource.Resource{
+		parseURL("http://bing.com/a"):  {URL: parseURL("http://bing.com/a"), External: true, Depth: 1},
+		parseURL("http://google.com/"): {URL: parseURL("http://google.com/"), External: true},
+	}
+	assert.Equal(t, "google.com", Root(external))
+}
+
+func TestSiteMapWritesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sitemap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	crawled := map[url.URL]resource.Resource{
+		parseURL("http://google.com/"): {URL: parseURL("http://google.com/"), Status: 200, ContentType: "text/html"},
+	}
+	for _, name := range Formats() {
+		m, err := New(name)
+		assert.NoError(t, err)
+		assert.NoError(t, m.SiteMap(dir, crawled), name)
+	}
+	for _, f := range []string{"google.com.txt", "google.com.cyjs", "google.com.dot", "google.com.gexf", "google.com.graphml", "google.com.html", "google.com.json", "google.com.jsonl", "google.com.svg", "google.com.tree.txt", "google.com/sitemap.xml"} {
+		_, err := os.Stat(filepath.Join(dir, f))
+		assert.NoError(t, err, f)
+	}
+}
@@ -0,0 +1,105 @@
+package sitemap
+
+import (
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/geotho/aragog/resource"
+	gv "github.com/geotho/gographviz"
+)
+
+// Merge combines the crawls of several sites into one. A URL in more than
+// one crawl keeps the Resource nearest a seed of a site it is in, so a page
+// crawled by its own site is not left marked External by another.
+func Merge(crawls ...map[url.URL]resource.Resource) map[url.URL]resource.Resource {
+	merged := make(map[url.URL]resource.Resource)
+	for _, crawled := range crawls {
+		for u, r := range crawled {
+			if m, ok := merged[u]; !ok || nearer(r, m) {
+				merged[u] = r
+			}
+		}
+	}
+	return merged
+}
+
+// nearer reports whether r is a better record of its URL than other: in
+// the crawl rather than External, reached by links rather than only via a
+// sitemap, or else at a shallower depth.
+func nearer(r, other resource.Resource) bool {
+	switch {
+	case r.External != other.External:
+		return !r.External
+	case r.ViaSitemap != other.ViaSitemap:
+		return !r.ViaSitemap
+	}
+	return r.Depth < other.Depth
+}
+
+// A CrossSiteMap draws how several crawled sites link to each other: a
+// node for each site labelled with its number of pages, and an edge from
+// each site to each other site it links to, labelled with the number of links.
+type CrossSiteMap struct {
+	// Hosts are the sites to draw. Links to other hosts are left out.
+	Hosts []string
+}
+
+// SiteMap writes the graph to dir/sites.dot.
+func (m *CrossSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, "sites.dot"), m, crawled)
+}
+
+// Encode writes the .dot source of the graph to w.
+func (m *CrossSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	pages := make(map[string]int, len(m.Hosts))
+	for _, h := range m.Hosts {
+		pages[h] = 0
+	}
+	links := make(map[edge]int)
+	for _, r := range crawled {
+		if _, ok := pages[r.URL.Host]; !ok || r.External {
+			continue
+		}
+		if Kind(r.URL) == KindPage || strings.Contains(r.ContentType, "html") {
+			pages[r.URL.Host]++
+		}
+		for l := range r.Links {
+			if _, ok := pages[l.Host]; ok && l.Host != r.URL.Host {
+				links[edge{r.URL.Host, l.Host}]++
+			}
+		}
+	}
+
+	g := gv.NewGraph()
+	g.SetName("G")
+	g.SetDir(true)
+	g.SetStrict(true)
+	hosts := append([]string{}, m.Hosts...)
+	sort.Strings(hosts)
+	for _, h := range hosts {
+		g.AddNode("G", quoteID(h), map[string]string{
+			"shape":     "box",
+			"style":     "filled",
+			"label":     quoteID(h + " (" + strconv.Itoa(pages[h]) + " pages)"),
+			"fillcolor": "#DDDDDD",
+		})
+	}
+	edges := make([]edge, 0, len(links))
+	for e := range links {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].from < edges[j].from || edges[i].from == edges[j].from && edges[i].to < edges[j].to
+	})
+	for _, e := range edges {
+		g.AddEdge(quoteID(e.from), quoteID(e.to), true, map[string]string{
+			"label": quoteID(strconv.Itoa(links[e]) + " links"),
+		})
+	}
+	_, err := io.WriteString(w, g.String())
+	return err
+}
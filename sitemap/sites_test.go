@@ -0,0 +1,55 @@
+package sitemap
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func sitesTestCrawl() map[url.URL]resource.Resource {
+	crawled := map[url.URL]resource.Resource{}
+	for _, r := range []resource.Resource{
+		{URL: parseURL("http://a.com/"), Status: 200, ContentType: "text/html", Links: makeURLMap("http://a.com/about", "http://b.com/", "http://b.com/pricing"), Assets: makeURLMap("http://cdn.com/app.js")},
+		{URL: parseURL("http://a.com/about"), Depth: 1, Status: 200, ContentType: "text/html", Links: makeURLMap("http://b.com/")},
+		{URL: parseURL("http://b.com/"), Status: 200, ContentType: "text/html", Links: makeURLMap("http://b.com/pricing", "http://a.com/")},
+		{URL: parseURL("http://b.com/pricing"), Depth: 1, Status: 200, ContentType: "text/html"},
+		{URL: parseURL("http://cdn.com/app.js"), Depth: 1, Status: 200, External: true},
+	} {
+		crawled[r.URL] = r
+	}
+	return crawled
+}
+
+func TestMerge(t *testing.T) {
+	a := map[url.URL]resource.Resource{}
+	b := map[url.URL]resource.Resource{}
+	for u, r := range sitesTestCrawl() {
+		if u.Host == "b.com" {
+			b[u] = r
+		} else {
+			a[u] = r
+		}
+	}
+	// a.com checked b.com's home page as external, further from its seed.
+	a[parseURL("http://b.com/")] = resource.Resource{URL: parseURL("http://b.com/"), Depth: 1, Status: 200, External: true}
+
+	merged := Merge(a, b)
+	assert.Equal(t, sitesTestCrawl(), merged)
+	assert.Equal(t, merged, Merge(b, a))
+}
+
+func TestCrossSiteMap(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, (&CrossSiteMap{Hosts: []string{"b.com", "a.com"}}).Encode(&b, sitesTestCrawl()))
+	dot := b.String()
+	assert.Contains(t, dot, `"a.com"`)
+	assert.Contains(t, dot, `"b.com"`)
+	assert.Contains(t, dot, `"a.com"->"b.com"`)
+	assert.Contains(t, dot, `"b.com"->"a.com"`)
+	assert.Contains(t, dot, `label="a.com (2 pages)"`)
+	assert.Contains(t, dot, `label="3 links"`)
+	assert.NotContains(t, dot, `cdn.com`)
+}
@@ -0,0 +1,315 @@
+package sitemap
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// An SVGSiteMap draws the crawl graph as an SVG, laid out in Go without
+// Graphviz. URLs are laid out in layers by crawl depth, ordered to keep
+// links between layers short.
+type SVGSiteMap struct {
+	// Assets draws assets as well as pages.
+	Assets bool
+	// MaxRowNodes is the most nodes in a row. Wider layers wrap onto
+	// several rows. Defaults to 30.
+	MaxRowNodes int
+}
+
+// The dimensions of an SVG sitemap, in pixels.
+const (
+	svgMargin     = 20
+	svgNodeHeight = 24
+	svgNodeGap    = 16
+	svgRowGap     = 36
+	svgLayerGap   = 90
+	svgCharWidth  = 6.6
+	svgMaxLabel   = 40
+	svgLayerLabel = 70
+)
+
+type svgNode struct {
+	label        string
+	x, y, width  float64
+	order        float64
+	preds, succs []int
+}
+
+// SiteMap writes the graph to dir/siteroot.svg.
+func (m *SVGSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return m.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes the graph to dir/name.svg.
+func (m *SVGSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, name+".svg"), m, crawled)
+}
+
+// Encode writes the graph to w as an SVG document.
+func (m *SVGSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	g := newGraph(crawled)
+	root := Root(crawled)
+
+	nodes, edges := m.nodes(g, root)
+	layers := m.layers(g, nodes)
+	width, height := m.place(layers, nodes)
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="Helvetica, Arial, sans-serif" font-size="11">
+<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="#888888"/></marker></defs>
+<rect width="100%%" height="100%%" fill="#FFFFFF"/>
+`, width, height, width, height)
+
+	for d, layer := range layers {
+		if len(layer) > 0 {
+			fmt.Fprintf(b, "<text x=\"%d\" y=\"%.1f\" fill=\"#888888\">depth %d</text>\n", svgMargin, nodes[layer[0]].y+svgNodeHeight/2+4, d)
+		}
+	}
+
+	for _, e := range edges {
+		from, to := nodes[e.From], nodes[e.To]
+		x1, y1 := from.x+from.width/2, from.y+svgNodeHeight
+		x2, y2 := to.x+to.width/2, to.y
+		bend := (y2 - y1) / 2
+		if bend < svgLayerGap/2 {
+			bend = svgLayerGap / 2
+		}
+		c1, c2 := y1+bend, y2-bend
+		switch {
+		case to.y == from.y:
+			// Links across a row arc over it, between the tops of the nodes.
+			y1 = from.y
+			c1, c2 = y1-svgLayerGap/2, y2-svgLayerGap/2
+		case to.y < from.y:
+			// Links back up go from the top of one node to the bottom of the other.
+			y1, y2 = from.y, to.y+svgNodeHeight
+			bend = (y1 - y2) / 2
+			c1, c2 = y1-bend, y2+bend
+		}
+		stroke, dash := "#999999", ""
+		switch e.Kind {
+		case EdgeAsset:
+			stroke, dash = "#BBBBBB", ` stroke-dasharray="4 3"`
+		case EdgeRedirect:
+			stroke, dash = "#3366CC", ` stroke-dasharray="2 2"`
+		}
+		fmt.Fprintf(b, "<path d=\"M%.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f\" fill=\"none\" stroke=\"%s\"%s marker-end=\"url(#arrow)\"/>\n",
+			x1, y1, x1, c1, x2, c2, x2, y2, stroke, dash)
+	}
+
+	for _, layer := range layers {
+		for _, i := range layer {
+			m.writeNode(b, g.nodes[i], nodes[i])
+		}
+	}
+
+	fmt.Fprint(b, "</svg>\n")
+	return b.Flush()
+}
+
+// nodes returns the nodes of g to draw, by index, and the edges between them.
+func (m *SVGSiteMap) nodes(g graph, root string) (map[int]*svgNode, []graphEdge) {
+	nodes := make(map[int]*svgNode)
+	for i, n := range g.nodes {
+		if m.Assets || Kind(n.URL) == KindPage || strings.Contains(n.ContentType, "html") {
+			nodes[i] = &svgNode{label: svgLabel(n.URL, root)}
+		}
+	}
+	var edges []graphEdge
+	for _, e := range g.edges {
+		if nodes[e.From] != nil && nodes[e.To] != nil && e.From != e.To {
+			edges = append(edges, e)
+			nodes[e.From].succs = append(nodes[e.From].succs, e.To)
+			nodes[e.To].preds = append(nodes[e.To].preds, e.From)
+		}
+	}
+	return nodes, edges
+}
+
+// layers groups the nodes by crawl depth, ordered within each layer to
+// reduce crossing edges. URLs that were not crawled go one layer below the
+// first URL referencing them.
+func (m *SVGSiteMap) layers(g graph, nodes map[int]*svgNode) [][]int {
+	depth := make(map[int]int, len(nodes))
+	var queue []int
+	for i := range nodes {
+		if g.nodes[i].Crawled {
+			depth[i] = g.nodes[i].Depth
+			queue = append(queue, i)
+		}
+	}
+	sort.Slice(queue, func(a, b int) bool {
+		return depth[queue[a]] < depth[queue[b]] || depth[queue[a]] == depth[queue[b]] && queue[a] < queue[b]
+	})
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, s := range nodes[i].succs {
+			if _, ok := depth[s]; !ok {
+				depth[s] = depth[i] + 1
+				queue = append(queue, s)
+			}
+		}
+	}
+
+	var layers [][]int
+	for i := 0; i < len(g.nodes); i++ {
+		if nodes[i] == nil {
+			continue
+		}
+		d, ok := depth[i]
+		if !ok {
+			d = 0
+		}
+		for len(layers) <= d {
+			layers = append(layers, nil)
+		}
+		nodes[i].order = float64(len(layers[d]))
+		layers[d] = append(layers[d], i)
+	}
+
+	// Order each layer by the mean position of the nodes linking to it from
+	// the layer above, then of the nodes it links to in the layer below.
+	for sweep := 0; sweep < 4; sweep++ {
+		for d := 1; d < len(layers); d++ {
+			orderBy(layers[d], nodes, func(n *svgNode) []int { return n.preds })
+		}
+		for d := len(layers) - 2; d >= 0; d-- {
+			orderBy(layers[d], nodes, func(n *svgNode) []int { return n.succs })
+		}
+	}
+	return layers
+}
+
+// orderBy sorts layer by the mean order of each node's neighbours, keeping
+// nodes without neighbours where they are.
+func orderBy(layer []int, nodes map[int]*svgNode, neighbours func(*svgNode) []int) {
+	keys := make(map[int]float64, len(layer))
+	for _, i := range layer {
+		n := nodes[i]
+		keys[i] = n.order
+		if ns := neighbours(n); len(ns) > 0 {
+			sum := 0.0
+			for _, j := range ns {
+				sum += nodes[j].order
+			}
+			keys[i] = sum / float64(len(ns))
+		}
+	}
+	sort.SliceStable(layer, func(a, b int) bool {
+		return keys[layer[a]] < keys[layer[b]]
+	})
+	for o, i := range layer {
+		nodes[i].order = float64(o)
+	}
+}
+
+// place sets the position of every node, wrapping wide layers onto several
+// rows and centring each row, and returns the size of the drawing.
+func (m *SVGSiteMap) place(layers [][]int, nodes map[int]*svgNode) (width, height float64) {
+	maxRow := m.MaxRowNodes
+	if maxRow <= 0 {
+		maxRow = 30
+	}
+
+	var rows [][]int
+	var rowY []float64
+	y := float64(svgMargin)
+	for _, layer := range layers {
+		for start := 0; start < len(layer); start += maxRow {
+			end := start + maxRow
+			if end > len(layer) {
+				end = len(layer)
+			}
+			rows = append(rows, layer[start:end])
+			rowY = append(rowY, y)
+			y += svgNodeHeight + svgRowGap
+		}
+		if len(layer) == 0 {
+			y += svgNodeHeight + svgRowGap
+		}
+		y += svgLayerGap - svgRowGap
+	}
+	height = y - svgLayerGap + svgRowGap + svgMargin
+	if len(layers) == 0 {
+		// An empty crawl is a blank drawing, not one of negative height.
+		height = 2 * svgMargin
+	}
+
+	rowWidths := make([]float64, len(rows))
+	for r, row := range rows {
+		for _, i := range row {
+			nodes[i].width = svgNodeWidth(nodes[i].label)
+			rowWidths[r] += nodes[i].width + svgNodeGap
+		}
+		rowWidths[r] -= svgNodeGap
+		if rowWidths[r] > width {
+			width = rowWidths[r]
+		}
+	}
+
+	for r, row := range rows {
+		x := svgMargin + svgLayerLabel + (width-rowWidths[r])/2
+		for _, i := range row {
+			nodes[i].x, nodes[i].y = x, rowY[r]
+			x += nodes[i].width + svgNodeGap
+		}
+	}
+	return width + 2*svgMargin + svgLayerLabel, height
+}
+
+// writeNode draws n as a box coloured by its kind, outlined red if it is broken.
+func (m *SVGSiteMap) writeNode(w io.Writer, r graphNode, n *svgNode) {
+	fill, stroke, dash := GraphvizURL{r.URL}.Colour(), "#777777", ""
+	switch {
+	case r.Status >= 400 || r.Error != "":
+		stroke = "#CC0000"
+	case r.RobotsDisallowed:
+		dash = ` stroke-dasharray="4 2"`
+	}
+	if r.External {
+		fill, dash = "#FFFFFF", ` stroke-dasharray="2 2"`
+	}
+
+	title := r.URL.String()
+	switch {
+	case r.Error != "":
+		title += "\n" + r.Error
+	case r.Status != 0:
+		title += fmt.Sprintf("\n%d %s, %d bytes, depth %d", r.Status, r.ContentType, r.Bytes, r.Depth)
+	case r.RobotsDisallowed:
+		title += "\ndisallowed by robots.txt"
+	case !r.Crawled:
+		title += "\nnot crawled"
+	}
+
+	fmt.Fprintf(w, "<g><title>%s</title><rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%d\" rx=\"4\" fill=\"%s\" stroke=\"%s\"%s/>",
+		html.EscapeString(title), n.x, n.y, n.width, svgNodeHeight, fill, stroke, dash)
+	fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\">%s</text></g>\n",
+		n.x+n.width/2, n.y+svgNodeHeight/2+4, html.EscapeString(n.label))
+}
+
+// svgLabel returns a short label for u: its path if it is on root, shortened to svgMaxLabel.
+func svgLabel(u url.URL, root string) string {
+	label := u.String()
+	if u.Host == root {
+		label = u.RequestURI()
+	}
+	if r := []rune(label); len(r) > svgMaxLabel {
+		label = string(r[:svgMaxLabel-1]) + "…"
+	}
+	return label
+}
+
+func svgNodeWidth(label string) float64 {
+	return 12 + svgCharWidth*float64(len([]rune(label)))
+}
@@ -0,0 +1,79 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"testing"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func svgTestCrawl() map[url.URL]resource.Resource {
+	crawled := map[url.URL]resource.Resource{}
+	for _, r := range []resource.Resource{
+		{URL: parseURL("http://google.com/"), Links: makeURLMap("http://google.com/b", "http://google.com/a"), Assets: makeURLMap("http://google.com/cat.png")},
+		{URL: parseURL("http://google.com/a"), Depth: 1, Links: makeURLMap("http://google.com/a/deep", "http://google.com/")},
+		{URL: parseURL("http://google.com/b"), Depth: 1, Status: 404},
+	} {
+		crawled[r.URL] = r
+	}
+	return crawled
+}
+
+func TestSVGSiteMapLayers(t *testing.T) {
+	crawled := svgTestCrawl()
+	g := newGraph(crawled)
+	layerURLs := func(m *SVGSiteMap) [][]string {
+		nodes, _ := m.nodes(g, "google.com")
+		var urls [][]string
+		for _, layer := range m.layers(g, nodes) {
+			var l []string
+			for _, i := range layer {
+				l = append(l, g.nodes[i].URL.String())
+			}
+			urls = append(urls, l)
+		}
+		return urls
+	}
+
+	assert.Equal(t, [][]string{
+		{"http://google.com/"},
+		{"http://google.com/a", "http://google.com/b"},
+		{"http://google.com/a/deep"},
+	}, layerURLs(&SVGSiteMap{}))
+	assert.Equal(t, [][]string{
+		{"http://google.com/"},
+		{"http://google.com/a", "http://google.com/b", "http://google.com/cat.png"},
+		{"http://google.com/a/deep"},
+	}, layerURLs(&SVGSiteMap{Assets: true}))
+}
+
+func TestSVGSiteMap(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&SVGSiteMap{MaxRowNodes: 1}).Encode(b, svgTestCrawl()))
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &struct{}{}))
+
+	s := b.String()
+	assert.Contains(t, s, `<svg xmlns="http://www.w3.org/2000/svg"`)
+	assert.Contains(t, s, ">/a/deep</text>")
+	assert.Contains(t, s, "<title>http://google.com/b\n404 , 0 bytes, depth 1</title>")
+	assert.Contains(t, s, `stroke="#CC0000"`)
+	assert.NotContains(t, s, "cat.png")
+	assert.Contains(t, s, ">depth 2</text>")
+}
+
+func TestSVGSiteMapEmpty(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, (&SVGSiteMap{}).Encode(b, map[url.URL]resource.Resource{}))
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &struct{}{}))
+
+	var svg struct {
+		Width  float64 `xml:"width,attr"`
+		Height float64 `xml:"height,attr"`
+	}
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &svg))
+	assert.True(t, svg.Width >= 0, "width %v", svg.Width)
+	assert.True(t, svg.Height >= 0, "height %v", svg.Height)
+}
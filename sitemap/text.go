@@ -1,14 +1,17 @@
 package sitemap
 
 import (
-	"bytes"
+	"bufio"
+	"fmt"
+	"io"
 	"net/url"
+	"path/filepath"
 	"sort"
 
 	"github.com/geotho/aragog/resource"
 )
 
-// TextSiteMap writes text sitemaps into the /out folder.
+// TextSiteMap writes a tab-indented list of each crawled URL with its links and assets.
 type TextSiteMap struct{}
 
 // Resources is an Resource slice that implements sort.Interface.
@@ -28,8 +31,19 @@ func (s Resources) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
-// SiteMap writes a text sitemap into the /out folder.
-func (t *TextSiteMap) SiteMap(crawled map[url.URL]resource.Resource) {
+// SiteMap writes a text sitemap to dir/siteroot.txt.
+func (t *TextSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return t.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes a text sitemap to dir/name.txt.
+func (t *TextSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, name+".txt"), t, crawled)
+}
+
+// Encode writes a text sitemap to w: each crawled URL on its own line,
+// followed by its metadata, links and assets on tab-indented lines.
+func (t *TextSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
 	pages := make(Resources, 0, len(crawled))
 
 	for _, v := range crawled {
@@ -38,22 +52,51 @@ func (t *TextSiteMap) SiteMap(crawled map[url.URL]resource.Resource) {
 
 	sort.Sort(pages)
 
-	b := bytes.Buffer{}
+	b := bufio.NewWriter(w)
 
 	for _, p := range pages {
-		b.WriteString(p.URL.String())
-		b.WriteString("\tLinks:")
-		for _, s := range URLMapToStringSlice(p.Links) {
-			b.WriteString("\t\t")
-			b.WriteString(s)
+		fmt.Fprintln(b, p.URL.String())
+		fmt.Fprintf(b, "\tDepth: %d\n", p.Depth)
+		if p.RobotsDisallowed {
+			fmt.Fprintln(b, "\tDisallowed by robots.txt")
+		}
+		if p.External {
+			fmt.Fprintln(b, "\tExternal")
+		}
+		if p.ViaSitemap {
+			fmt.Fprintln(b, "\tVia sitemap")
 		}
-		b.WriteString("\tAssets:")
-		for _, s := range URLMapToStringSlice(p.Assets) {
-			b.WriteString("\t\t")
-			b.WriteString(s)
+		if p.Status != 0 {
+			fmt.Fprintf(b, "\tStatus: %d\n\tType: %s\n\tBytes: %d\n\tTTFB: %s\n\tTime: %s\n", p.Status, p.ContentType, p.Bytes, p.TTFB, p.Duration)
 		}
+		if p.Error != "" {
+			fmt.Fprintf(b, "\tError: %s\n", p.Error)
+		}
+		if len(p.Redirects) > 0 {
+			fmt.Fprintln(b, "\tRedirects:")
+			for _, r := range p.Redirects {
+				fmt.Fprintf(b, "\t\t%d %s ->\n", r.Status, r.URL.String())
+			}
+			fmt.Fprintf(b, "\t\t%s\n", p.FinalURL.String())
+		}
+		fmt.Fprintln(b, "\tLinks:")
+		writeRefs(b, p, p.Links)
+		fmt.Fprintln(b, "\tAssets:")
+		writeRefs(b, p, p.Assets)
 	}
 
+	return b.Flush()
+}
+
+// writeRefs writes a line for each of refs, which p references, marking those on other hosts.
+func writeRefs(w io.Writer, p resource.Resource, refs map[url.URL]bool) {
+	for _, u := range sortedURLs(refs) {
+		if p.IsExternal(u) {
+			fmt.Fprintf(w, "\t\t%s (external)\n", u.String())
+		} else {
+			fmt.Fprintf(w, "\t\t%s\n", u.String())
+		}
+	}
 }
 
 // URLMapToStringSlice converts a map of urls into a sorted string slice.
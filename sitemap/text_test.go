@@ -0,0 +1,62 @@
+package sitemap
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// textTestCrawls are the crawls to compare with testdata/text_<name>.golden.
+var textTestCrawls = map[string][]resource.Resource{
+	"site": {
+		{URL: parseURL("http://finely.co"), Status: 200, ContentType: "text/html", Links: makeURLMap("http://finely.co", "http://finely.co/about/", "http://finely.co/work/"), Assets: makeURLMap("http://finely.co/style.css", "http://finely.co/main.js")},
+		{URL: parseURL("http://finely.co/about/"), Depth: 1, Status: 200, ContentType: "text/html", Links: makeURLMap("http://finely.co", "http://finely.co/work/"), Assets: makeURLMap("http://finely.co/style.css")},
+		{URL: parseURL("http://finely.co/work/"), Depth: 1, Status: 200, ContentType: "text/html", Links: makeURLMap("http://finely.co", "http://finely.co/about/"), Assets: makeURLMap("http://finely.co/style.css", "http://finely.co/work.jpg")},
+		{URL: parseURL("http://finely.co/style.css"), Depth: 1, Status: 200, ContentType: "text/css"},
+	},
+	"metadata": {
+		{
+			URL: parseURL("http://google.com/"), Status: 200, ContentType: "text/html; charset=utf-8",
+			Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}, Bytes: 1234, TTFB: 50 * time.Millisecond, Duration: 120 * time.Millisecond,
+			Links:  makeURLMap("http://google.com/old", "http://google.com/private", "http://example.com/"),
+			Assets: makeURLMap("http://cdn.example.com/app.js"),
+		},
+		{
+			URL: parseURL("http://google.com/old"), Depth: 1, Status: 200, ContentType: "text/html", Bytes: 10,
+			FinalURL:  parseURL("http://google.com/new"),
+			Redirects: []resource.Redirect{{URL: parseURL("http://google.com/old"), Status: 301}, {URL: parseURL("http://google.com/newer"), Status: 302}},
+		},
+		{URL: parseURL("http://google.com/private"), RobotsDisallowed: true, ViaSitemap: true},
+		{URL: parseURL("http://example.com/"), Depth: 1, External: true, Error: "dial tcp: no such host"},
+	},
+}
+
+func TestTextSiteMapGolden(t *testing.T) {
+	for name, rs := range textTestCrawls {
+		crawled := map[url.URL]resource.Resource{}
+		for _, r := range rs {
+			crawled[r.URL] = r
+		}
+
+		var b bytes.Buffer
+		assert.NoError(t, (&TextSiteMap{}).Encode(&b, crawled), name)
+
+		golden := filepath.Join("testdata", "text_"+name+".golden")
+		if *update {
+			assert.NoError(t, ioutil.WriteFile(golden, b.Bytes(), 0644), name)
+		}
+		want, err := ioutil.ReadFile(golden)
+		assert.NoError(t, err, name)
+		assert.Equal(t, string(want), b.String(), name)
+	}
+}
@@ -0,0 +1,206 @@
+package sitemap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// A TreeSiteMap writes the crawled pages as an indented tree, like the
+// tree command: by default a directory tree of their paths, or the tree
+// of links through which the crawl first reached each page.
+type TreeSiteMap struct {
+	// SpanningTree draws the breadth-first spanning tree of links from the
+	// seeds, instead of the directory tree.
+	SpanningTree bool
+}
+
+// A treeNode is a path segment or page in a TreeSiteMap.
+type treeNode struct {
+	name     string
+	page     *resource.Resource
+	children []*treeNode
+}
+
+// SiteMap writes the tree to dir/siteroot.tree.txt.
+func (t *TreeSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return t.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes the tree to dir/name.tree.txt.
+func (t *TreeSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return writeFile(filepath.Join(dir, name+".tree.txt"), t, crawled)
+}
+
+// Encode writes the tree to w. Each page is followed by the number of
+// children it has in the tree, the number of assets it uses and the number
+// of pages linking to it.
+func (t *TreeSiteMap) Encode(w io.Writer, crawled map[url.URL]resource.Resource) error {
+	pages := make(map[url.URL]resource.Resource)
+	for u, r := range crawled {
+		if !r.External && (Kind(u) == KindPage || strings.Contains(r.ContentType, "html")) {
+			pages[u] = r
+		}
+	}
+
+	inbound := make(map[url.URL]int)
+	for u, r := range pages {
+		for l := range r.Links {
+			if l != u {
+				inbound[l]++
+			}
+		}
+	}
+
+	var roots []*treeNode
+	if t.SpanningTree {
+		roots = spanningTree(pages)
+	} else {
+		roots = pathTree(pages)
+	}
+
+	b := bufio.NewWriter(w)
+	for _, root := range roots {
+		writeTreeNode(b, root, "", "", inbound)
+	}
+	return b.Flush()
+}
+
+// pathTree returns a tree for each host, with a node for each segment of the paths of pages.
+func pathTree(pages map[url.URL]resource.Resource) []*treeNode {
+	hosts := make(map[string]*treeNode)
+	for _, r := range sortedResources(pages) {
+		r := r
+		host, ok := hosts[r.URL.Host]
+		if !ok {
+			host = &treeNode{name: r.URL.Host}
+			hosts[r.URL.Host] = host
+		}
+
+		segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if r.URL.RawQuery != "" {
+			segments[len(segments)-1] += "?" + r.URL.RawQuery
+		}
+		n := host
+		for i, s := range segments {
+			if s == "" && i == len(segments)-1 {
+				break
+			}
+			if i < len(segments)-1 {
+				s += "/"
+			}
+			n = n.child(s)
+		}
+		if n.page == nil {
+			n.page = &r
+		}
+	}
+
+	roots := make([]*treeNode, 0, len(hosts))
+	for _, host := range hosts {
+		roots = append(roots, host)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].name < roots[j].name
+	})
+	return roots
+}
+
+// child returns n's child called name, adding it if need be. A page and
+// a directory with the same name share a node, named as the directory.
+func (n *treeNode) child(name string) *treeNode {
+	for _, c := range n.children {
+		if strings.TrimSuffix(c.name, "/") == strings.TrimSuffix(name, "/") {
+			if strings.HasSuffix(name, "/") {
+				c.name = name
+			}
+			return c
+		}
+	}
+	c := &treeNode{name: name}
+	n.children = append(n.children, c)
+	return c
+}
+
+// spanningTree returns the breadth-first tree of links from the seeds,
+// which are the pages at depth 0 not found via a sitemap, to every page
+// they reach. Pages reached only via a sitemap follow, under a
+// "(via sitemap)" node.
+func spanningTree(pages map[url.URL]resource.Resource) []*treeNode {
+	seen := make(map[url.URL]bool)
+	roots := spanFrom(pages, seen, func(r resource.Resource) bool { return r.Depth == 0 && !r.ViaSitemap })
+	if listed := spanFrom(pages, seen, func(r resource.Resource) bool { return r.Depth == 0 }); len(listed) > 0 {
+		roots = append(roots, &treeNode{name: "(via sitemap)", children: listed})
+	}
+	return roots
+}
+
+// spanFrom returns the breadth-first trees of links from the pages not yet
+// seen for which root is true, adding every page in them to seen.
+func spanFrom(pages map[url.URL]resource.Resource, seen map[url.URL]bool, root func(resource.Resource) bool) []*treeNode {
+	var roots, queue []*treeNode
+	for _, r := range sortedResources(pages) {
+		if !seen[r.URL] && root(r) {
+			r := r
+			n := &treeNode{name: r.URL.String(), page: &r}
+			roots = append(roots, n)
+			queue = append(queue, n)
+			seen[r.URL] = true
+		}
+	}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, l := range sortedURLs(n.page.Links) {
+			r, ok := pages[l]
+			if !ok || seen[l] {
+				continue
+			}
+			seen[l] = true
+			c := &treeNode{name: l.RequestURI(), page: &r}
+			n.children = append(n.children, c)
+			queue = append(queue, c)
+		}
+	}
+	return roots
+}
+
+// writeTreeNode writes n and its children, drawing the branches to them.
+func writeTreeNode(w io.Writer, n *treeNode, first, rest string, inbound map[url.URL]int) {
+	fmt.Fprintf(w, "%s%s%s\n", first, n.name, n.counts(inbound))
+	for i, c := range n.children {
+		if i == len(n.children)-1 {
+			writeTreeNode(w, c, rest+"└── ", rest+"    ", inbound)
+		} else {
+			writeTreeNode(w, c, rest+"├── ", rest+"│   ", inbound)
+		}
+	}
+}
+
+// counts describes n: its status if that is not OK, and its numbers of
+// children, assets and inbound links.
+func (n *treeNode) counts(inbound map[url.URL]int) string {
+	if n.page == nil {
+		return fmt.Sprintf(" [%d children]", len(n.children))
+	}
+	p := n.page
+	var status string
+	switch {
+	case p.Error != "":
+		status = " (" + p.Error + ")"
+	case p.RobotsDisallowed:
+		status = " (disallowed by robots.txt)"
+	case len(p.Redirects) > 0:
+		status = fmt.Sprintf(" (%d to %s)", p.Redirects[0].Status, p.FinalURL.String())
+	case p.Status != 0 && p.Status != 200:
+		status = fmt.Sprintf(" (%d)", p.Status)
+	}
+	return fmt.Sprintf("%s [%d children, %d assets, %d inbound]", status, len(n.children), len(p.Assets), inbound[p.URL])
+}
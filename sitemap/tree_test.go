@@ -0,0 +1,70 @@
+package sitemap
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func treeTestCrawl() map[url.URL]resource.Resource {
+	crawled := map[url.URL]resource.Resource{}
+	for _, r := range []resource.Resource{
+		{URL: parseURL("http://google.com/"), Status: 200, Links: makeURLMap("http://google.com/docs/", "http://google.com/about", "http://google.com/docs/intro"), Assets: makeURLMap("http://google.com/cat.png")},
+		{URL: parseURL("http://google.com/about"), Depth: 1, Status: 200, Links: makeURLMap("http://google.com/")},
+		{URL: parseURL("http://google.com/docs/"), Depth: 1, Status: 200, Links: makeURLMap("http://google.com/docs/intro", "http://google.com/docs/api/ref")},
+		{URL: parseURL("http://google.com/docs/intro"), Depth: 1, Status: 404},
+		{URL: parseURL("http://google.com/docs/api/ref"), Depth: 2, Status: 200, Assets: makeURLMap("http://google.com/cat.png")},
+		{URL: parseURL("http://google.com/cat.png"), Depth: 1, Status: 200, ContentType: "image/png"},
+	} {
+		crawled[r.URL] = r
+	}
+	return crawled
+}
+
+func TestTreeSiteMapPaths(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, (&TreeSiteMap{}).Encode(&b, treeTestCrawl()))
+	assert.Equal(t, `google.com [2 children, 1 assets, 1 inbound]
+├── about [0 children, 0 assets, 1 inbound]
+└── docs/ [2 children, 0 assets, 1 inbound]
+    ├── api/ [1 children]
+    │   └── ref [0 children, 1 assets, 1 inbound]
+    └── intro (404) [0 children, 0 assets, 2 inbound]
+`, b.String())
+}
+
+func TestTreeSiteMapSpanningTree(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, (&TreeSiteMap{SpanningTree: true}).Encode(&b, treeTestCrawl()))
+	assert.Equal(t, `http://google.com/ [3 children, 1 assets, 1 inbound]
+├── /about [0 children, 0 assets, 1 inbound]
+├── /docs/ [1 children, 0 assets, 1 inbound]
+│   └── /docs/api/ref [0 children, 1 assets, 1 inbound]
+└── /docs/intro (404) [0 children, 0 assets, 2 inbound]
+`, b.String())
+}
+
+func TestTreeSiteMapSpanningTreeViaSitemap(t *testing.T) {
+	crawled := treeTestCrawl()
+	for _, r := range []resource.Resource{
+		{URL: parseURL("http://google.com/landing"), ViaSitemap: true, Status: 200, Links: makeURLMap("http://google.com/landing/offer", "http://google.com/about")},
+		{URL: parseURL("http://google.com/landing/offer"), Depth: 1, ViaSitemap: true, Status: 200},
+	} {
+		crawled[r.URL] = r
+	}
+
+	var b bytes.Buffer
+	assert.NoError(t, (&TreeSiteMap{SpanningTree: true}).Encode(&b, crawled))
+	assert.Equal(t, `http://google.com/ [3 children, 1 assets, 1 inbound]
+├── /about [0 children, 0 assets, 2 inbound]
+├── /docs/ [1 children, 0 assets, 1 inbound]
+│   └── /docs/api/ref [0 children, 1 assets, 1 inbound]
+└── /docs/intro (404) [0 children, 0 assets, 2 inbound]
+(via sitemap) [1 children]
+└── http://google.com/landing [1 children, 0 assets, 0 inbound]
+    └── /landing/offer [0 children, 0 assets, 1 inbound]
+`, b.String())
+}
@@ -0,0 +1,275 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geotho/aragog/resource"
+)
+
+// The limits on a single sitemap file set by sitemaps.org. Bigger sitemaps
+// are split into several files listed by a sitemap index.
+const (
+	MaxSitemapURLs  = 50000
+	MaxSitemapBytes = 50 << 20
+)
+
+const sitemapXMLNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// ChangeFreqs are the valid values of XMLRule.ChangeFreq.
+var ChangeFreqs = []string{"always", "hourly", "daily", "weekly", "monthly", "yearly", "never"}
+
+// An XMLSiteMap writes a sitemaps.org sitemap.xml of the crawled HTML pages,
+// for submitting to search engines.
+type XMLSiteMap struct {
+	// BaseURL is where the sitemap files will be served from, used for the
+	// locations in a sitemap index. It defaults to the root of the crawled site.
+	BaseURL string
+	// Rules set the changefreq and priority of pages. The first matching rule wins.
+	Rules []XMLRule
+	// Gzip compresses each file, adding .gz to its name.
+	Gzip bool
+	// MaxURLs and MaxBytes limit the size of each file. They default to,
+	// and cannot exceed, MaxSitemapURLs and MaxSitemapBytes.
+	MaxURLs  int
+	MaxBytes int
+}
+
+// An XMLRule sets the changefreq and priority of pages whose path starts with Prefix.
+type XMLRule struct {
+	Prefix string
+	// ChangeFreq is one of ChangeFreqs, or "" to omit it.
+	ChangeFreq string
+	// Priority is from 0.0 to 1.0, or nil to omit it, leaving the default of 0.5.
+	Priority *float64
+}
+
+// ParseXMLRule parses a rule of the form "prefix=changefreq[,priority]",
+// e.g. "/blog/=daily,0.8". Either changefreq or priority may be empty.
+func ParseXMLRule(s string) (XMLRule, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return XMLRule{}, fmt.Errorf("sitemap rule %q is not of the form prefix=changefreq[,priority]", s)
+	}
+	rule := XMLRule{Prefix: s[:i]}
+	fields := strings.SplitN(s[i+1:], ",", 2)
+
+	rule.ChangeFreq = fields[0]
+	if rule.ChangeFreq != "" && !isChangeFreq(rule.ChangeFreq) {
+		return XMLRule{}, fmt.Errorf("sitemap rule %q has changefreq %q, not one of %s", s, rule.ChangeFreq, strings.Join(ChangeFreqs, ", "))
+	}
+
+	if len(fields) == 2 && fields[1] != "" {
+		p, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || p < 0 || p > 1 {
+			return XMLRule{}, fmt.Errorf("sitemap rule %q has priority %q, not between 0.0 and 1.0", s, fields[1])
+		}
+		rule.Priority = &p
+	}
+	return rule, nil
+}
+
+func isChangeFreq(s string) bool {
+	for _, f := range ChangeFreqs {
+		if s == f {
+			return true
+		}
+	}
+	return false
+}
+
+type xmlURL struct {
+	XMLName    xml.Name `xml:"url"`
+	Loc        string   `xml:"loc"`
+	LastMod    string   `xml:"lastmod,omitempty"`
+	ChangeFreq string   `xml:"changefreq,omitempty"`
+	Priority   string   `xml:"priority,omitempty"`
+}
+
+type xmlSitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []xmlSitemap `xml:"sitemap"`
+}
+
+type xmlSitemap struct {
+	Loc string `xml:"loc"`
+}
+
+// SiteMap writes sitemap.xml, and any other files it needs, to dir/siteroot/.
+func (m *XMLSiteMap) SiteMap(dir string, crawled map[url.URL]resource.Resource) error {
+	return m.SiteMapNamed(dir, Root(crawled), crawled)
+}
+
+// SiteMapNamed writes sitemap.xml, and any other files it needs, to dir/name/.
+func (m *XMLSiteMap) SiteMapNamed(dir, name string, crawled map[url.URL]resource.Resource) error {
+	return m.Write(filepath.Join(dir, name), crawled)
+}
+
+// Write writes sitemap.xml to dir. If the pages do not fit in one file they
+// are split across sitemap-1.xml, sitemap-2.xml, etc. and sitemap.xml is
+// instead a sitemap index listing them.
+func (m *XMLSiteMap) Write(dir string, crawled map[url.URL]resource.Resource) error {
+	pages := Pages(crawled)
+	if len(pages) == 0 {
+		return nil
+	}
+
+	base := url.URL{Scheme: pages[0].URL.Scheme, Host: pages[0].URL.Host, Path: "/"}
+	if m.BaseURL != "" {
+		b, err := url.Parse(m.BaseURL)
+		if err != nil {
+			return err
+		}
+		base = *b
+		// BaseURL is a directory, even without a trailing slash.
+		if !strings.HasSuffix(base.Path, "/") {
+			base.Path += "/"
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	files, err := m.urlsets(pages)
+	if err != nil {
+		return err
+	}
+	if len(files) == 1 {
+		return m.writeFile(filepath.Join(dir, "sitemap.xml"), files[0])
+	}
+
+	index := xmlSitemapIndex{XMLNS: sitemapXMLNS}
+	for i, f := range files {
+		name := fmt.Sprintf("sitemap-%d.xml", i+1)
+		if err := m.writeFile(filepath.Join(dir, name), f); err != nil {
+			return err
+		}
+		if m.Gzip {
+			name += ".gz"
+		}
+		index.Sitemaps = append(index.Sitemaps, xmlSitemap{Loc: base.ResolveReference(&url.URL{Path: name}).String()})
+	}
+
+	b, err := xml.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return m.writeFile(filepath.Join(dir, "sitemap.xml"), append([]byte(xml.Header), append(b, '\n')...))
+}
+
+// urlsets encodes pages as one or more <urlset> documents, each within MaxURLs and MaxBytes.
+func (m *XMLSiteMap) urlsets(pages Resources) ([][]byte, error) {
+	maxURLs, maxBytes := m.MaxURLs, m.MaxBytes
+	if maxURLs <= 0 || maxURLs > MaxSitemapURLs {
+		maxURLs = MaxSitemapURLs
+	}
+	if maxBytes <= 0 || maxBytes > MaxSitemapBytes {
+		maxBytes = MaxSitemapBytes
+	}
+
+	header := xml.Header + `<urlset xmlns="` + sitemapXMLNS + `">` + "\n"
+	footer := "</urlset>\n"
+
+	var files [][]byte
+	var b bytes.Buffer
+	n := 0
+	for _, p := range pages {
+		entry, err := xml.MarshalIndent(m.entry(p), "  ", "  ")
+		if err != nil {
+			return nil, err
+		}
+		entry = append(entry, '\n')
+
+		if n > 0 && (n == maxURLs || b.Len()+len(entry)+len(footer) > maxBytes) {
+			b.WriteString(footer)
+			files = append(files, append([]byte(nil), b.Bytes()...))
+			b.Reset()
+			n = 0
+		}
+		if n == 0 {
+			b.WriteString(header)
+		}
+		b.Write(entry)
+		n++
+	}
+	b.WriteString(footer)
+	return append(files, b.Bytes()), nil
+}
+
+// entry returns the <url> element for p.
+func (m *XMLSiteMap) entry(p resource.Resource) xmlURL {
+	e := xmlURL{Loc: p.URL.String()}
+	if t, err := http.ParseTime(p.Header.Get("Last-Modified")); err == nil {
+		e.LastMod = t.UTC().Format(time.RFC3339)
+	}
+	for _, r := range m.Rules {
+		if strings.HasPrefix(p.URL.Path, r.Prefix) {
+			e.ChangeFreq = r.ChangeFreq
+			if r.Priority != nil {
+				e.Priority = strconv.FormatFloat(*r.Priority, 'f', -1, 64)
+			}
+			break
+		}
+	}
+	return e
+}
+
+// writeFile writes b to path, or compressed to path.gz if m.Gzip is set.
+func (m *XMLSiteMap) writeFile(path string, b []byte) error {
+	if m.Gzip {
+		path += ".gz"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if m.Gzip {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	if _, err := w.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// Pages returns the crawled resources that belong in a sitemap, sorted by
+// URL: successfully fetched, in-scope HTML pages that were not redirected
+// and do not ask not to be indexed.
+func Pages(crawled map[url.URL]resource.Resource) Resources {
+	pages := make(Resources, 0, len(crawled))
+	for _, r := range crawled {
+		if r.External || r.RobotsDisallowed || len(r.Redirects) > 0 ||
+			r.Status < 200 || r.Status >= 300 ||
+			!strings.Contains(r.ContentType, "html") ||
+			strings.Contains(strings.ToLower(r.Header.Get("X-Robots-Tag")), "noindex") {
+			continue
+		}
+		pages = append(pages, r)
+	}
+	sort.Sort(pages)
+	return pages
+}
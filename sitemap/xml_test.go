@@ -0,0 +1,140 @@
+package sitemap
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geotho/aragog/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func xmlTestCrawl() map[url.URL]resource.Resource {
+	html := func(u string, header http.Header) resource.Resource {
+		return resource.Resource{URL: parseURL(u), Status: 200, ContentType: "text/html; charset=utf-8", Header: header}
+	}
+	crawled := map[url.URL]resource.Resource{}
+	for _, r := range []resource.Resource{
+		html("http://google.com/", http.Header{"Last-Modified": {"Wed, 21 Oct 2015 07:28:00 GMT"}}),
+		html("http://google.com/blog/a?x=1&y=2", nil),
+		html("http://google.com/secret", http.Header{"X-Robots-Tag": {"noindex"}}),
+		{URL: parseURL("http://google.com/cat.png"), Status: 200, ContentType: "image/png"},
+		{URL: parseURL("http://google.com/missing"), Status: 404, ContentType: "text/html"},
+		{URL: parseURL("http://google.com/private"), RobotsDisallowed: true},
+		{URL: parseURL("http://bing.com/"), Status: 200, ContentType: "text/html", External: true},
+	} {
+		crawled[r.URL] = r
+	}
+	return crawled
+}
+
+func TestXMLSiteMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sitemap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &XMLSiteMap{Rules: []XMLRule{
+		{Prefix: "/blog/", ChangeFreq: "daily", Priority: priority(0.8)},
+		{Prefix: "/", Priority: priority(0)},
+	}}
+	assert.NoError(t, m.Write(dir, xmlTestCrawl()))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "sitemap.xml"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>http://google.com/</loc>
+    <lastmod>2015-10-21T07:28:00Z</lastmod>
+    <priority>0</priority>
+  </url>
+  <url>
+    <loc>http://google.com/blog/a?x=1&amp;y=2</loc>
+    <changefreq>daily</changefreq>
+    <priority>0.8</priority>
+  </url>
+</urlset>
+`, string(b))
+}
+
+func TestXMLSiteMapSplits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sitemap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &XMLSiteMap{MaxURLs: 1, Gzip: true, BaseURL: "https://google.com/maps"}
+	assert.NoError(t, m.Write(dir, xmlTestCrawl()))
+
+	index := readGzip(t, filepath.Join(dir, "sitemap.xml.gz"))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap>
+    <loc>https://google.com/maps/sitemap-1.xml.gz</loc>
+  </sitemap>
+  <sitemap>
+    <loc>https://google.com/maps/sitemap-2.xml.gz</loc>
+  </sitemap>
+</sitemapindex>
+`, index)
+	assert.Contains(t, readGzip(t, filepath.Join(dir, "sitemap-1.xml.gz")), "<loc>http://google.com/</loc>")
+	assert.Contains(t, readGzip(t, filepath.Join(dir, "sitemap-2.xml.gz")), "<loc>http://google.com/blog/a?x=1&amp;y=2</loc>")
+}
+
+func TestXMLSiteMapSplitsBySize(t *testing.T) {
+	m := &XMLSiteMap{MaxBytes: 250}
+	files, err := m.urlsets(Pages(xmlTestCrawl()))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	for _, f := range files {
+		assert.True(t, len(f) <= 250, "file is %d bytes", len(f))
+		assert.True(t, strings.HasSuffix(string(f), "</urlset>\n"))
+	}
+}
+
+func TestParseXMLRule(t *testing.T) {
+	r, err := ParseXMLRule("/blog/=daily,0.8")
+	assert.NoError(t, err)
+	assert.Equal(t, XMLRule{Prefix: "/blog/", ChangeFreq: "daily", Priority: priority(0.8)}, r)
+
+	r, err = ParseXMLRule("/=,1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, XMLRule{Prefix: "/", Priority: priority(1)}, r)
+
+	r, err = ParseXMLRule("/old/=never,0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, XMLRule{Prefix: "/old/", ChangeFreq: "never", Priority: priority(0)}, r)
+
+	r, err = ParseXMLRule("/=daily")
+	assert.NoError(t, err)
+	assert.Nil(t, r.Priority)
+
+	for _, bad := range []string{"/blog/", "/=sometimes", "/=daily,2", "/=daily,high"} {
+		_, err := ParseXMLRule(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func priority(p float64) *float64 {
+	return &p
+}
+
+func readGzip(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func parseURL(parseMe string) url.URL {
+	u, _ := url.Parse(parseMe)
+	return *u
+}